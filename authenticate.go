@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+// the scopedToken requireScope (or publicScope) already checked
+const scopedTokenKey contextKey = iota
+
+// scopedToken is a personal access token or an OAuth access token, both are limited to their scopes
+type scopedToken struct {
+	token  string
+	userID uuid.UUID
+}
+
+// requireScope lets personal access tokens and OAuth access tokens with the scope into the handler.
+// Handlers without it only accept JWTs from a login, and those are never limited by scopes
+func (c *apiConfig) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, hasScope, ok := c.checkScope(w, r, scope)
+		if !ok {
+			return
+		}
+		if !hasScope {
+			writeJSONResponse(w, 403, map[string]string{"error": fmt.Sprintf("Token is missing the %s scope", scope)})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// publicScope is requireScope for endpoints anyone can use without a token.
+// A scoped token without the scope is treated like no token, instead of doing less than an anonymous caller
+func (c *apiConfig) publicScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, hasScope, ok := c.checkScope(w, r, scope)
+		if !ok {
+			return
+		}
+		if !hasScope {
+			r = r.Clone(r.Context())
+			r.Header.Del("Authorization")
+		}
+		next(w, r)
+	}
+}
+
+// checkScope looks up the scopes of a personal access token or OAuth access token, and adds the token to the
+// request when it has the scope. Requests without a scoped token always have the scope.
+// It writes a 401 and returns false when the token is invalid
+func (c *apiConfig) checkScope(w http.ResponseWriter, r *http.Request, scope string) (*http.Request, bool, bool) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return r, true, true
+	}
+
+	var userID uuid.UUID
+	var scopes []string
+	if auth.IsPersonalAccessToken(tokenString) {
+		token, err := c.dbQueries.GetPersonalAccessToken(r.Context(), auth.HashToken(tokenString))
+		if err != nil {
+			writeJSONResponse(w, 401, map[string]string{"error": "Token is invalid, revoked or has expired"})
+			return r, false, false
+		}
+
+		// NOTE: not critical, the token is still valid
+		if err = c.dbQueries.TouchPersonalAccessToken(r.Context(), token.ID); err != nil {
+			fmt.Printf("Error updating token last used: %v\n", err)
+		}
+		userID, scopes = token.UserID, token.Scopes
+	} else {
+		claims, err := auth.ParseJWT(tokenString, c.jwtKeys)
+		// a login JWT can do everything, and a bad one is rejected by the handler
+		if err != nil || claims.ClientID == "" {
+			return r, true, true
+		}
+		userID, err = claims.UserID()
+		if err != nil {
+			writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+			return r, false, false
+		}
+		scopes = claims.Scopes()
+	}
+
+	if !slices.Contains(scopes, scope) {
+		return r, false, true
+	}
+	return r.WithContext(context.WithValue(r.Context(), scopedTokenKey, scopedToken{token: tokenString, userID: userID})), true, true
+}
+
+// validateAccessToken checks the JWT and that the session it came from has not been revoked,
+// returning the user and session ids. Scoped tokens have no session, and only work behind requireScope
+func (c *apiConfig) validateAccessToken(ctx context.Context, tokenString string) (uuid.UUID, uuid.UUID, error) {
+	scoped, _ := ctx.Value(scopedTokenKey).(scopedToken)
+
+	if auth.IsPersonalAccessToken(tokenString) {
+		if scoped.token != tokenString {
+			return uuid.Nil, uuid.Nil, errors.New("Personal access tokens cant be used here")
+		}
+		return scoped.userID, uuid.Nil, nil
+	}
+
+	claims, err := auth.ParseJWT(tokenString, c.jwtKeys)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	sessionID, err := claims.Session()
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	// the session of an OAuth token is its grant
+	if claims.ClientID != "" {
+		if scoped.token != tokenString {
+			return uuid.Nil, uuid.Nil, errors.New("OAuth tokens cant be used here")
+		}
+		active, err := c.dbQueries.IsOAuthGrantActive(ctx, sessionID)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		if !active {
+			return uuid.Nil, uuid.Nil, errors.New("Access has been revoked")
+		}
+		return userID, uuid.Nil, nil
+	}
+
+	// NOTE: only the HS256 tokens made before sessions existed dont have one, and ParseJWT stops accepting those an hour after SECRET_CUTOFF
+	if sessionID != uuid.Nil {
+		active, err := c.dbQueries.IsSessionActive(ctx, sessionID)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		if !active {
+			return uuid.Nil, uuid.Nil, errors.New("Session has been revoked")
+		}
+
+		// NOTE: not critical, the session is still valid
+		if err = c.dbQueries.TouchSession(ctx, sessionID); err != nil {
+			fmt.Printf("Error updating session last used: %v\n", err)
+		}
+	}
+
+	return userID, sessionID, nil
+}
+
+// authenticateSession reads the bearer token, writing a 401 if it is missing or no longer valid
+func (c *apiConfig) authenticateSession(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, sessionID, err := c.validateAccessToken(r.Context(), userToken)
+	if err != nil {
+		writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, sessionID, true
+}
+
+// authenticateUser is authenticateSession for handlers that only need the user
+func (c *apiConfig) authenticateUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, _, ok := c.authenticateSession(w, r)
+	return userID, ok
+}
+
+// requireRole only lets users with the role (or a more trusted one) into the handler.
+// Only JWTs from a login get in, personal access tokens and OAuth tokens never have a role.
+// The role is read from the db, not the token, so a lowered role takes effect right away
+func (c *apiConfig) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+			return
+		}
+
+		// validateAccessToken rejects scoped tokens here, and revoked sessions
+		userID, _, err := c.validateAccessToken(r.Context(), tokenString)
+		if err != nil {
+			writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+			return
+		}
+		user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+			return
+		}
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+
+		if !auth.HasRole(user.Role, role) {
+			writeJSONResponse(w, 403, map[string]string{"error": fmt.Sprintf("You need the %s role for this", role)})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
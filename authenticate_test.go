@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// personalAccessTokens answers the personal access token queries, for a token with the scopes
+func personalAccessTokens(userID uuid.UUID, token string, scopes string) map[string]fakeQuery {
+	return map[string]fakeQuery{
+		"GetPersonalAccessToken": func(args []driver.Value) ([][]driver.Value, error) {
+			if args[0] != auth.HashToken(token) {
+				return nil, nil
+			}
+			return [][]driver.Value{{uuid.NewString(), userID.String(), "test", args[0], scopes, time.Now(), time.Now().Add(time.Hour), nil, nil}}, nil
+		},
+		"TouchPersonalAccessToken": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+	}
+}
+
+func TestScopesOnPublicReads(t *testing.T) {
+	const token = "chirpy_pat_test"
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		wrap       func(*apiConfig, string, http.HandlerFunc) http.HandlerFunc
+		header     string
+		scopes     string
+		wantStatus int
+		wantToken  bool // whether the handler still gets the token
+	}{
+		{"public, no token", (*apiConfig).publicScope, "", "{chirps:read}", 200, false},
+		{"public, with the scope", (*apiConfig).publicScope, "Bearer " + token, "{chirps:read}", 200, true},
+		{"public, without the scope", (*apiConfig).publicScope, "Bearer " + token, "{chirps:write}", 200, false},
+		{"public, invalid token", (*apiConfig).publicScope, "Bearer chirpy_pat_revoked", "{chirps:read}", 401, false},
+		{"required, with the scope", (*apiConfig).requireScope, "Bearer " + token, "{chirps:read}", 200, true},
+		{"required, without the scope", (*apiConfig).requireScope, "Bearer " + token, "{chirps:write}", 403, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiCfg, _ := newFakeDB(t, personalAccessTokens(userID, token, tt.scopes))
+
+			gotToken := false
+			next := func(w http.ResponseWriter, r *http.Request) {
+				scoped, _ := r.Context().Value(scopedTokenKey).(scopedToken)
+				gotToken = r.Header.Get("Authorization") != "" && scoped.userID == userID
+				w.WriteHeader(200)
+			}
+
+			r := httptest.NewRequest("GET", "/api/chirps", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			tt.wrap(apiCfg, auth.ScopeChirpsRead, next)(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if gotToken != tt.wantToken {
+				t.Errorf("expected the handler to get the token to be %v", tt.wantToken)
+			}
+		})
+	}
+}
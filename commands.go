@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+)
+
+// runCommand runs `chirpy <command> ...` from the server's shell instead of starting the server.
+// grant-role is how the first admin is made, since only admins can change roles through the API:
+//
+//	chirpy grant-role you@example.com admin
+func runCommand(db *sql.DB, queries *database.Queries, args []string) error {
+	switch args[0] {
+	case "grant-role":
+		if len(args) != 3 {
+			return errors.New("usage: chirpy grant-role <email> <role>")
+		}
+		email, role := args[1], args[2]
+		if !slices.Contains(auth.Roles, role) {
+			return fmt.Errorf("role must be one of %s", strings.Join(auth.Roles, ", "))
+		}
+
+		ctx := context.Background()
+		user, err := queries.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user with the email %s, sign up first", email)
+		}
+		if err != nil {
+			return err
+		}
+
+		user, err = setUserRole(ctx, db, queries, user, role)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", user.Email, user.Role)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, the only one is grant-role", args[0])
+}
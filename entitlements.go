@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Entitlements are the limits of a user's plan. Everything Chirpy Red changes is set here,
+// handlers ask for the user's entitlements instead of checking is_chirpy_red themselves
+type Entitlements struct {
+	Plan                   string `json:"plan"` // free or red
+	MaxChirpLength         int    `json:"max_chirp_length"`
+	MaxConversationMembers int    `json:"max_conversation_members"` // including the person who starts it
+	DataExportsPerDay      int    `json:"data_exports_per_day"`
+}
+
+var (
+	freeEntitlements = Entitlements{
+		Plan:                   "free",
+		MaxChirpLength:         140,
+		MaxConversationMembers: 10,
+		DataExportsPerDay:      3,
+	}
+	// NOTE: chirps.body is VARCHAR(500), raise it along with MaxChirpLength
+	redEntitlements = Entitlements{
+		Plan:                   "red",
+		MaxChirpLength:         500,
+		MaxConversationMembers: 50,
+		DataExportsPerDay:      10,
+	}
+)
+
+func entitlementsFor(user database.User) Entitlements {
+	if user.IsChirpyRed {
+		return redEntitlements
+	}
+	return freeEntitlements
+}
+
+// entitlements looks up the user's plan, and writes the error response if it can't
+func (c *apiConfig) entitlements(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (Entitlements, bool) {
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return Entitlements{}, false
+	}
+	return entitlementsFor(user), true
+}
+
+// checkLimit allows value up to the limit the user's plan has for feature. Past it the response is
+// 402 when Chirpy Red would allow it, so clients can offer the upgrade, and 400 when no plan does
+func checkLimit(w http.ResponseWriter, e Entitlements, feature string, value int, limit func(Entitlements) int, message string) bool {
+	if value <= limit(e) {
+		return true
+	}
+	if value <= limit(redEntitlements) {
+		writeJSONResponse(w, 402, map[string]string{
+			"error":         fmt.Sprintf("%s, Chirpy Red allows up to %d", message, limit(redEntitlements)),
+			"feature":       feature,
+			"required_plan": redEntitlements.Plan,
+		})
+		return false
+	}
+	writeJSONResponse(w, 400, map[string]string{"error": fmt.Sprintf("%s, the most is %d", message, limit(redEntitlements))})
+	return false
+}
+
+// GET /api/users/me/entitlements
+func (c *apiConfig) handlerGetEntitlements(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	entitlements, ok := c.entitlements(w, r, userID)
+	if !ok {
+		return
+	}
+	writeJSONResponse(w, 200, entitlements)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+)
+
+// fakeQuery answers one sqlc query. It gets the query's arguments and returns its rows,
+// for :exec and :execrows queries the number of rows is the number of rows affected
+type fakeQuery func(args []driver.Value) ([][]driver.Value, error)
+
+// fakeDB is a database/sql driver that answers the sqlc queries by their name,
+// so handlers can be tested without a postgres server.
+// Queries without an answer fail the test
+type fakeDB struct {
+	t       *testing.T
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+	calls   map[string]int
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// newFakeDB returns an apiConfig whose database is answered by queries
+func newFakeDB(t *testing.T, queries map[string]fakeQuery) (*apiConfig, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{t: t, queries: queries, calls: map[string]int{}}
+
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeDBsMu.Unlock()
+	t.Cleanup(func() {
+		fakeDBsMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeDBsMu.Unlock()
+	})
+
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &apiConfig{db: db, dbQueries: database.New(db)}, f
+}
+
+// Calls is how many times the query ran
+func (f *fakeDB) Calls(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+func (f *fakeDB) run(query string, args []driver.Value) ([][]driver.Value, error) {
+	// every sqlc query starts with "-- name: Name :kind"
+	name := ""
+	if fields := strings.Fields(query); len(fields) > 2 && fields[0] == "--" && fields[1] == "name:" {
+		name = fields[2]
+	}
+
+	f.mu.Lock()
+	f.calls[name]++
+	answer, ok := f.queries[name]
+	f.mu.Unlock()
+	if !ok {
+		f.t.Errorf("unexpected query %q", name)
+		return nil, fmt.Errorf("fakedb: no answer for %q", name)
+	}
+	return answer(args)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	f, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unknown database %q", name)
+	}
+	return &fakeConn{db: f}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+// NOTE: transactions are not kept apart, a rollback keeps what the queries did
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// fakeTextArray reads a text[] argument, what pq.Array sends
+func fakeTextArray(v driver.Value) []string {
+	s, _ := v.(string)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	if s == "" {
+		return nil
+	}
+	values := strings.Split(s, ",")
+	for i, value := range values {
+		values[i] = strings.Trim(value, `"`)
+	}
+	return values
+}
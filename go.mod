@@ -9,4 +9,8 @@ require (
 	golang.org/x/crypto v0.31.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+require github.com/golang-jwt/jwt/v5 v5.2.1
+
+require github.com/gorilla/websocket v1.5.3
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -1,51 +1,108 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
-	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
 	"github.com/google/uuid"
 	"net/http"
 	"time"
 )
 
+// PUT /api/users
+// changes the login itself, so it takes a login JWT and the current password, scoped tokens can't get here
 func (c *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
 	// authenticate the user using their JWT
-	userToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
-		return
-	}
-
-	userID, err := auth.ValidateJWT(userToken, c.secret)
-	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
 		return
 	}
 
 	// check provided parameters
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Could not decode your request"})
 		return
 	}
 
+	currentUser, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	// a stolen access token alone is not enough to take over the account
+	// NOTE: verifyPassword counts wrong guesses like a login
+	if _, err = c.verifyPassword(r, currentUser.Email, params.CurrentPassword); err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
+	// NOTE: checked before anything is saved, the new email can't be the password either
+	if !c.checkNewPassword(w, params.Password, currentUser.Email) {
+		return
+	}
+	if params.Email != currentUser.Email && !c.checkNewPassword(w, params.Password, params.Email) {
+		return
+	}
+
+	// NOTE: nothing is saved unless all of it is
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	// a new email only takes effect once it is confirmed through POST /api/users/verify
+	emailChanged := params.Email != currentUser.Email
+	if emailChanged {
+		if !validEmail(params.Email) {
+			writeJSONResponse(w, 400, map[string]string{"error": "Invalid email"})
+			return
+		}
+		if _, err := qtx.GetUserByEmail(r.Context(), params.Email); err == nil {
+			writeJSONResponse(w, 409, map[string]string{"error": "That email is already in use"})
+			return
+		}
+		recent, err := qtx.CountRecentEmailVerificationTokens(r.Context(), userID)
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+		if recent >= maxVerificationEmailsPerHour {
+			writeJSONResponse(w, 429, map[string]string{"error": errTooManyVerificationEmails.Error()})
+			return
+		}
+
+		err = qtx.SetPendingEmail(r.Context(), database.SetPendingEmailParams{
+			ID:           userID,
+			PendingEmail: sql.NullString{String: params.Email, Valid: true},
+		})
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Failed to save your new information to the database"})
+			return
+		}
+	}
+
 	// hash the password
-	hPassword, err := auth.HashPassword(params.Password)
+	hPassword, err := c.passwords.Hash(params.Password)
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Failed to hash your password"})
 		return
 	}
 
-	// update the email and password
-	user, err := c.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email:          params.Email,
+	// update the password, the email stays the same until the new one is verified
+	user, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
+		Email:          currentUser.Email,
 		HashedPassword: hPassword,
 		ID:             userID,
 	})
@@ -54,20 +111,42 @@ func (c *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// whoever had the old password should not stay logged in
+	if params.Password != params.CurrentPassword {
+		if err = qtx.RevokeAllSessions(r.Context(), userID); err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to save your new information to the database"})
+		return
+	}
+
+	// NOTE: if it never arrives, POST /api/users/verify/resend sends it to the pending email again
+	if emailChanged {
+		go c.sendVerificationEmailInBackground(currentUser, params.Email)
+	}
+
 	// Send back the data
 	type userResponse struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		PendingEmail  string    `json:"pending_email,omitempty"` // waiting to be verified
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
 	}
 	response := userResponse{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		IsChirpyRed:   user.IsChirpyRed,
 	}
 
 	writeJSONResponse(w, 200, response)
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// POST /admin/users/{userID}/unlock
+// clears the failed logins of an account, the IPs they came from stay locked
+func (c *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	err = c.dbQueries.ClearLoginThrottle(r.Context(), accountThrottleKey(user.Email))
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// PUT /admin/users/{userID}/role
+func (c *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+	if !slices.Contains(auth.Roles, params.Role) {
+		writeJSONResponse(w, 400, map[string]string{"error": fmt.Sprintf("role must be one of %s", strings.Join(auth.Roles, ", "))})
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	// NOTE: so the last admin cant lock everyone out by accident
+	if userID == adminID {
+		writeJSONResponse(w, 400, map[string]string{"error": "You cant change your own role"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	user, err = setUserRole(r.Context(), c.db, c.dbQueries, user, params.Role)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string]string{"id": user.ID.String(), "email": user.Email, "role": user.Role})
+}
+
+// setUserRole changes the role, a lowered role also logs the user out everywhere,
+// otherwise their access tokens would keep the old role until they expire
+func setUserRole(ctx context.Context, db *sql.DB, queries *database.Queries, user database.User, role string) (database.User, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := queries.WithTx(tx)
+
+	updated, err := qtx.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   user.ID,
+		Role: role,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if !auth.HasRole(role, user.Role) {
+		if err = qtx.RevokeAllSessions(ctx, user.ID); err != nil {
+			return database.User{}, err
+		}
+	}
+
+	return updated, tx.Commit()
+}
+
+type WebhookEventJson struct {
+	ID          string          `json:"id"`
+	Source      string          `json:"source"`
+	Event       string          `json:"event"`
+	Status      string          `json:"status"` // received, processed, ignored or failed
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+func webhookEventJson(event database.WebhookEvent) WebhookEventJson {
+	response := WebhookEventJson{
+		ID:          event.ID,
+		Source:      event.Source,
+		Event:       event.Event,
+		Status:      event.Status,
+		Error:       event.Error.String,
+		Attempts:    event.Attempts,
+		ReceivedAt:  event.ReceivedAt,
+		ProcessedAt: nullTimePtr(event.ProcessedAt),
+	}
+	// NOTE: events from before the ledger have no payload
+	if json.Valid([]byte(event.Payload)) {
+		response.Payload = json.RawMessage(event.Payload)
+	}
+	return response
+}
+
+// GET /admin/webhooks?status=failed&limit=20&offset=0
+// newest first, status is optional
+func (c *apiConfig) handlerGetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	events, err := c.dbQueries.GetWebhookEvents(r.Context(), database.GetWebhookEventsParams{
+		Status: r.URL.Query().Get("status"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := []WebhookEventJson{}
+	for _, event := range events {
+		response = append(response, webhookEventJson(event))
+	}
+	writeJSONResponse(w, 200, response)
+}
+
+// POST /admin/webhooks/{source}/{eventID}/replay
+// applies the stored event again, also when it was processed already
+func (c *apiConfig) handlerReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	source, eventID := r.PathValue("source"), r.PathValue("eventID")
+
+	err := c.applyWebhookEvent(r.Context(), source, eventID, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 422, map[string]string{"error": fmt.Sprintf("Event failed again: %v", err)})
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// POST /api/users/{userID}/block
+// neither user can follow or message the other while the block lasts, and their follows are removed
+func (c *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	blockedID, ok := c.getOtherUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	err = qtx.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	err = qtx.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+		FollowerID: userID,
+		FolloweeID: blockedID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// DELETE /api/users/{userID}/block
+// the follows a block removed are not brought back
+func (c *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	unblocked, err := c.dbQueries.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if unblocked == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "You haven't blocked this user"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// GET /api/users/me/blocks?limit=20&offset=0
+// newest first
+func (c *apiConfig) handlerGetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	blocked, err := c.dbQueries.GetBlockedUsers(r.Context(), database.GetBlockedUsersParams{
+		BlockerID: userID,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := []FollowJson{}
+	for _, block := range blocked {
+		response = append(response, FollowJson{UserId: block.BlockedID, Since: block.CreatedAt})
+	}
+	writeJSONResponse(w, 200, response)
+}
+
+// POST /api/users/{userID}/mute
+// muted users are left out of recommendations and don't notify you, unlike a block they aren't stopped from anything
+func (c *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	mutedID, ok := c.getOtherUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := c.dbQueries.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// DELETE /api/users/{userID}/mute
+func (c *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	mutedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	unmuted, err := c.dbQueries.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if unmuted == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "You haven't muted this user"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// GET /api/users/me/mutes?limit=20&offset=0
+// newest first
+func (c *apiConfig) handlerGetMutedUsers(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	muted, err := c.dbQueries.GetMutedUsers(r.Context(), database.GetMutedUsersParams{
+		MuterID: userID,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := []FollowJson{}
+	for _, mute := range muted {
+		response = append(response, FollowJson{UserId: mute.MutedID, Since: mute.CreatedAt})
+	}
+	writeJSONResponse(w, 200, response)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type ConversationMemberJson struct {
+	UserId     uuid.UUID  `json:"user_id"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LastReadAt *time.Time `json:"last_read_at"` // read receipts, null if they never opened it
+}
+
+type ConversationJson struct {
+	ID          uuid.UUID                `json:"id"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	Members     []ConversationMemberJson `json:"members"`
+	UnreadCount int64                    `json:"unread_count"`
+}
+
+func (c *apiConfig) conversationResponse(ctx context.Context, conversation database.Conversation, unreadCount int64) (ConversationJson, error) {
+	members, err := c.dbQueries.GetConversationMembers(ctx, conversation.ID)
+	if err != nil {
+		return ConversationJson{}, err
+	}
+
+	response := ConversationJson{
+		ID:          conversation.ID,
+		CreatedAt:   conversation.CreatedAt,
+		UpdatedAt:   conversation.UpdatedAt,
+		Members:     []ConversationMemberJson{},
+		UnreadCount: unreadCount,
+	}
+	for _, member := range members {
+		m := ConversationMemberJson{
+			UserId:   member.UserID,
+			JoinedAt: member.JoinedAt,
+		}
+		if member.LastReadAt.Valid {
+			m.LastReadAt = &member.LastReadAt.Time
+		}
+		response.Members = append(response.Members, m)
+	}
+	return response, nil
+}
+
+// getConversationMember returns the conversation id from the path if the user is in it.
+// Conversations the user is not in are treated as not found so their existence isnt leaked
+func (c *apiConfig) getConversationMember(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "Conversation not found"})
+		return uuid.Nil, false
+	}
+
+	_, err = c.dbQueries.GetConversationMember(r.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "Conversation not found"})
+		return uuid.Nil, false
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get the conversation"})
+		return uuid.Nil, false
+	}
+	return conversationID, true
+}
+
+// checkCanMessage writes a 403 when the sender can't message one of the recipients,
+// because either of them blocked the other or the recipient only takes messages from their followers
+func (c *apiConfig) checkCanMessage(w http.ResponseWriter, r *http.Request, senderID uuid.UUID, recipients []uuid.UUID) bool {
+	for _, id := range recipients {
+		restriction, err := c.dbQueries.GetMessagingRestriction(r.Context(), database.GetMessagingRestrictionParams{
+			SenderID:    senderID,
+			RecipientID: id,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONResponse(w, 404, map[string]string{"error": fmt.Sprintf("User %s not found", id)})
+			return false
+		}
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return false
+		}
+
+		switch restriction {
+		case "blocked":
+			writeJSONResponse(w, 403, map[string]string{"error": fmt.Sprintf("You can't message user %s", id)})
+			return false
+		case "followers_only":
+			writeJSONResponse(w, 403, map[string]string{"error": fmt.Sprintf("User %s only takes messages from people who follow them", id)})
+			return false
+		}
+	}
+	return true
+}
+
+// POST /api/conversations
+// one other user_id starts (or returns the existing) one-to-one conversation, more starts a group
+func (c *apiConfig) handlerPostConversation(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		UserIds []uuid.UUID `json:"user_ids"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	// everyone else in the conversation, without duplicates
+	others := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{userID: true}
+	for _, id := range params.UserIds {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Provide at least one other user_id"})
+		return
+	}
+	entitlements, ok := c.entitlements(w, r, userID)
+	if !ok {
+		return
+	}
+	maxMembers := func(e Entitlements) int { return e.MaxConversationMembers }
+	if !checkLimit(w, entitlements, "large_conversations", len(others)+1, maxMembers, "Too many members") {
+		return
+	}
+
+	// also 404s for users that don't exist.
+	// NOTE: checked before reusing a conversation too, a block since then still applies
+	if !c.checkCanMessage(w, r, userID, others) {
+		return
+	}
+
+	// reuse the one-to-one conversation if there already is one
+	if len(others) == 1 {
+		conversation, err := c.dbQueries.GetDirectConversation(r.Context(), database.GetDirectConversationParams{
+			UserID:   userID,
+			UserID_2: others[0],
+		})
+		if err == nil {
+			response, err := c.conversationResponse(r.Context(), conversation, 0)
+			if err != nil {
+				writeJSONResponse(w, 500, map[string]string{"error": "Could not get the conversation"})
+				return
+			}
+			writeJSONResponse(w, 200, response)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			writeJSONResponse(w, 500, map[string]string{"error": "Could not get the conversation"})
+			return
+		}
+	}
+
+	// create the conversation and its members together
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	conversation, err := qtx.CreateConversation(r.Context(), uuid.New())
+	if err != nil {
+		fmt.Printf("Error creating conversation: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to create conversation"})
+		return
+	}
+	for _, id := range append([]uuid.UUID{userID}, others...) {
+		err = qtx.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+			ConversationID: conversation.ID,
+			UserID:         id,
+		})
+		if err != nil {
+			fmt.Printf("Error adding conversation member: %v\n", err)
+			writeJSONResponse(w, 500, map[string]string{"error": "Failed to create conversation"})
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to create conversation"})
+		return
+	}
+
+	response, err := c.conversationResponse(r.Context(), conversation, 0)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get the conversation"})
+		return
+	}
+	writeJSONResponse(w, 201, response)
+}
+
+// GET /api/conversations?limit=20&offset=0
+// most recently active first
+func (c *apiConfig) handlerGetConversations(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	conversations, err := c.dbQueries.GetConversationsForUser(r.Context(), database.GetConversationsForUserParams{
+		UserID: userID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		fmt.Printf("Error getting conversations: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your conversations"})
+		return
+	}
+
+	response := []ConversationJson{}
+	for _, conv := range conversations {
+		conversation, err := c.conversationResponse(r.Context(), database.Conversation{
+			ID:        conv.ID,
+			CreatedAt: conv.CreatedAt,
+			UpdatedAt: conv.UpdatedAt,
+		}, conv.UnreadCount)
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Could not get your conversations"})
+			return
+		}
+		response = append(response, conversation)
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// POST /api/conversations/{conversationID}/read
+// everything in the conversation up to now has been read
+func (c *apiConfig) handlerReadConversation(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversationID, ok := c.getConversationMember(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := c.dbQueries.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not mark the conversation as read"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
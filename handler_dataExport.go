@@ -0,0 +1,439 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type DataExportJson struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"` // pending, ready or failed
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// POST /api/users/me/export
+// the archive is built in the background by dataExportJob, poll GET /api/users/me/export/{exportID} for it
+func (c *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	// each export reads everything the user has, so how many they can ask for per day depends on their plan
+	entitlements, ok := c.entitlements(w, r, userID)
+	if !ok {
+		return
+	}
+	recent, err := c.dbQueries.CountRecentDataExports(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if recent >= int64(entitlements.DataExportsPerDay) {
+		writeJSONResponse(w, 429, map[string]string{"error": fmt.Sprintf("At most %d exports per day, try again tomorrow", entitlements.DataExportsPerDay)})
+		return
+	}
+
+	export, err := c.dbQueries.CreateDataExport(r.Context(), database.CreateDataExportParams{
+		ID:     uuid.New(),
+		UserID: userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 202, DataExportJson{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	})
+}
+
+// GET /api/users/me/export/{exportID}
+// responds with the zip once it is ready, and with the export's status before that
+func (c *apiConfig) handlerGetDataExport(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "Export not found"})
+		return
+	}
+
+	export, err := c.dbQueries.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "Export not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	if export.Status != "ready" {
+		writeJSONResponse(w, 200, DataExportJson{
+			ID:          export.ID,
+			Status:      export.Status,
+			CreatedAt:   export.CreatedAt,
+			CompletedAt: nullTimePtr(export.CompletedAt),
+		})
+		return
+	}
+
+	archive, err := c.dbQueries.GetDataExportArchive(r.Context(), database.GetDataExportArchiveParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	// NOTE: expired exports are deleted by the job, until then they are only hidden
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 410, map[string]string{"error": "Export has expired, ask for a new one"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.CompletedAt.Time.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	w.Write(archive)
+}
+
+// dataExportJob builds the pending exports and deletes the expired ones
+func (c *apiConfig) dataExportJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		for {
+			export, err := c.dbQueries.ClaimDataExport(ctx)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				fmt.Println("Could not claim a data export:", err)
+				break
+			}
+
+			archive, err := c.buildDataExport(ctx, export.UserID)
+			if err != nil {
+				fmt.Printf("Could not build data export %s: %v\n", export.ID, err)
+				if err = c.dbQueries.FailDataExport(ctx, export.ID); err != nil {
+					fmt.Println("Could not mark data export as failed:", err)
+				}
+				continue
+			}
+
+			err = c.dbQueries.CompleteDataExport(ctx, database.CompleteDataExportParams{
+				ID:      export.ID,
+				Archive: archive,
+			})
+			if err != nil {
+				fmt.Printf("Could not save data export %s: %v\n", export.ID, err)
+			}
+		}
+
+		if _, err := c.dbQueries.DeleteExpiredDataExports(ctx); err != nil {
+			fmt.Println("Could not delete expired data exports:", err)
+		}
+	}
+}
+
+// buildDataExport zips everything Chirpy has about the user, one JSON file per kind.
+// Secrets (password hash, tokens, 2FA) are left out, they are no use outside of Chirpy.
+// Personal access tokens and OAuth grants are listed, without the tokens themselves
+func (c *apiConfig) buildDataExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	user, err := c.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := c.dbQueries.GetChirps(ctx, database.GetChirpsParams{Column1: userID, Column2: "asc"})
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.dbQueries.GetActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := c.dbQueries.GetMessagesBySender(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	received, err := c.dbQueries.GetMessagesForRecipient(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := c.dbQueries.GetNotificationsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// users who never subscribed have no row, their plan is still in the entitlements
+	subscription, err := c.dbQueries.GetSubscription(ctx, userID)
+	hasSubscription := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	grants, err := c.dbQueries.GetOAuthGrantsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := c.dbQueries.GetPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := c.dbQueries.GetUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// the list queries are paged, the export wants every row
+	following, err := c.dbQueries.GetFollowing(ctx, database.GetFollowingParams{FollowerID: userID, Limit: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+	followers, err := c.dbQueries.GetFollowers(ctx, database.GetFollowersParams{FolloweeID: userID, Limit: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := c.dbQueries.GetBlockedUsers(ctx, database.GetBlockedUsersParams{BlockerID: userID, Limit: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+	mutes, err := c.dbQueries.GetMutedUsers(ctx, database.GetMutedUsersParams{MuterID: userID, Limit: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+
+	type profileJson struct {
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		PendingEmail  string    `json:"pending_email,omitempty"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
+		Role          string    `json:"role"`
+		Handle        string    `json:"handle,omitempty"`
+	}
+	profile := profileJson{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		Handle:        user.Handle.String,
+	}
+
+	chirpsJson := []ChirpJson{}
+	for _, chirp := range chirps {
+		chirpsJson = append(chirpsJson, ChirpJson{
+			ID:        chirp.ID,
+			UserId:    chirp.UserID,
+			CreatedAt: chirp.CreatedAt,
+			UpdatedAt: chirp.UpdatedAt,
+			Body:      chirp.Body,
+		})
+	}
+
+	sessionsJson := []SessionJson{}
+	for _, session := range sessions {
+		sessionsJson = append(sessionsJson, SessionJson{
+			ID:         session.FamilyID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			SignedInAt: session.SignedInAt,
+			LastUsedAt: session.LastUsedAt,
+		})
+	}
+
+	type messageJson struct {
+		ID             uuid.UUID `json:"id"`
+		ConversationID uuid.UUID `json:"conversation_id"`
+		SenderID       uuid.UUID `json:"sender_id"`
+		CreatedAt      time.Time `json:"created_at"`
+		Body           string    `json:"body"`
+	}
+	type messagesJson struct {
+		Sent     []messageJson `json:"sent"`
+		Received []messageJson `json:"received"`
+	}
+	messages := messagesJson{Sent: []messageJson{}, Received: []messageJson{}}
+	for _, message := range sent {
+		messages.Sent = append(messages.Sent, messageJson{
+			ID:             message.ID,
+			ConversationID: message.ConversationID,
+			SenderID:       message.SenderID,
+			CreatedAt:      message.CreatedAt,
+			Body:           message.Body,
+		})
+	}
+	for _, message := range received {
+		messages.Received = append(messages.Received, messageJson{
+			ID:             message.ID,
+			ConversationID: message.ConversationID,
+			SenderID:       message.SenderID,
+			CreatedAt:      message.CreatedAt,
+			Body:           message.Body,
+		})
+	}
+
+	type notificationJson struct {
+		ID        uuid.UUID  `json:"id"`
+		Type      string     `json:"type"`
+		ActorId   uuid.UUID  `json:"actor_id"`
+		ChirpId   *uuid.UUID `json:"chirp_id"`
+		CreatedAt time.Time  `json:"created_at"`
+		ReadAt    *time.Time `json:"read_at"`
+	}
+	notificationsJson := []notificationJson{}
+	for _, notification := range notifications {
+		n := notificationJson{
+			ID:        notification.ID,
+			Type:      notification.Type,
+			ActorId:   notification.ActorID,
+			CreatedAt: notification.CreatedAt,
+			ReadAt:    nullTimePtr(notification.ReadAt),
+		}
+		if notification.ChirpID.Valid {
+			n.ChirpId = &notification.ChirpID.UUID
+		}
+		notificationsJson = append(notificationsJson, n)
+	}
+
+	type planJson struct {
+		Entitlements Entitlements      `json:"entitlements"`
+		Subscription *SubscriptionJson `json:"subscription"` // null if they never subscribed
+	}
+	plan := planJson{Entitlements: entitlementsFor(user)}
+	if hasSubscription {
+		plan.Subscription = &SubscriptionJson{
+			Plan:             subscription.Plan,
+			Status:           subscription.Status,
+			CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+			CanceledAt:       nullTimePtr(subscription.CanceledAt),
+		}
+	}
+
+	grantsJson := []OAuthGrantJson{}
+	for _, grant := range grants {
+		grantsJson = append(grantsJson, OAuthGrantJson{
+			ID:         grant.ID,
+			ClientID:   grant.ClientID,
+			ClientName: grant.ClientName,
+			Scopes:     grant.Scopes,
+			CreatedAt:  grant.CreatedAt,
+		})
+	}
+
+	tokensJson := []PersonalAccessTokenJson{}
+	for _, token := range tokens {
+		tokensJson = append(tokensJson, personalAccessTokenResponse(token))
+	}
+
+	type identityJson struct {
+		Provider    string    `json:"provider"`
+		Subject     string    `json:"subject"`
+		Email       string    `json:"email"`
+		LinkedAt    time.Time `json:"linked_at"`
+		LastLoginAt time.Time `json:"last_login_at"`
+	}
+	identitiesJson := []identityJson{}
+	for _, identity := range identities {
+		identitiesJson = append(identitiesJson, identityJson{
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LinkedAt:    identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	type followsJson struct {
+		Following []FollowJson `json:"following"`
+		Followers []FollowJson `json:"followers"`
+	}
+	follows := followsJson{Following: []FollowJson{}, Followers: []FollowJson{}}
+	for _, followee := range following {
+		follows.Following = append(follows.Following, FollowJson{UserId: followee.FolloweeID, Since: followee.CreatedAt})
+	}
+	for _, follower := range followers {
+		follows.Followers = append(follows.Followers, FollowJson{UserId: follower.FollowerID, Since: follower.CreatedAt})
+	}
+
+	blocksJson := []FollowJson{}
+	for _, block := range blocks {
+		blocksJson = append(blocksJson, FollowJson{UserId: block.BlockedID, Since: block.CreatedAt})
+	}
+	mutesJson := []FollowJson{}
+	for _, mute := range mutes {
+		mutesJson = append(mutesJson, FollowJson{UserId: mute.MutedID, Since: mute.CreatedAt})
+	}
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", chirpsJson},
+		{"sessions.json", sessionsJson},
+		{"messages.json", messages},
+		{"notifications.json", notificationsJson},
+		{"subscription.json", plan},
+		{"identities.json", identitiesJson},
+		{"oauth_grants.json", grantsJson},
+		{"personal_access_tokens.json", tokensJson},
+		{"follows.json", follows},
+		{"blocks.json", blocksJson},
+		{"mutes.json", mutesJson},
+	}
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
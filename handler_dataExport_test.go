@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildDataExport(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	conversationID := uuid.New()
+	chirpID := uuid.New()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	none := func(args []driver.Value) ([][]driver.Value, error) { return nil, nil }
+	apiCfg, _ := newFakeDB(t, map[string]fakeQuery{
+		"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{userID.String(), now, now, "user@example.com", "hash", true, now, nil, "user", nil, "everyone", "user"}}, nil
+		},
+		"GetChirps":         none,
+		"GetActiveSessions": none,
+		"GetUserIdentities": none,
+		"GetFollowing":      none,
+		"GetFollowers":      none,
+		"GetBlockedUsers":   none,
+		"GetMutedUsers":     none,
+		"GetMessagesBySender": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{uuid.NewString(), conversationID.String(), userID.String(), now, now, "hi"}}, nil
+		},
+		"GetMessagesForRecipient": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{uuid.NewString(), conversationID.String(), otherID.String(), now, now, "hello back"}}, nil
+		},
+		"GetNotificationsForUser": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{uuid.NewString(), now, now, userID.String(), otherID.String(), notificationMention, chirpID.String(), nil}}, nil
+		},
+		"GetSubscription": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{userID.String(), "red", "active", now.Add(30 * 24 * time.Hour), nil, now, now}}, nil
+		},
+		"GetOAuthGrantsForUser": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{uuid.NewString(), uuid.NewString(), "Some app", "{chirps:read}", now}}, nil
+		},
+		"GetPersonalAccessTokens": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{uuid.NewString(), userID.String(), "laptop", "the hash", "{chirps:write}", now, now.Add(time.Hour), nil, nil}}, nil
+		},
+	})
+
+	archive, err := apiCfg.buildDataExport(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{
+		"profile.json", "chirps.json", "sessions.json", "messages.json", "notifications.json", "subscription.json",
+		"identities.json", "oauth_grants.json", "personal_access_tokens.json", "follows.json", "blocks.json", "mutes.json",
+	} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the export", name)
+		}
+	}
+
+	var messages struct {
+		Sent     []map[string]any `json:"sent"`
+		Received []map[string]any `json:"received"`
+	}
+	if err = json.Unmarshal(files["messages.json"], &messages); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages.Sent) != 1 || len(messages.Received) != 1 || messages.Received[0]["sender_id"] != otherID.String() {
+		t.Errorf("expected the sent and received messages, got %s", files["messages.json"])
+	}
+
+	var notifications []map[string]any
+	if err = json.Unmarshal(files["notifications.json"], &notifications); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0]["chirp_id"] != chirpID.String() {
+		t.Errorf("expected the notification, got %s", files["notifications.json"])
+	}
+
+	var plan struct {
+		Entitlements Entitlements      `json:"entitlements"`
+		Subscription *SubscriptionJson `json:"subscription"`
+	}
+	if err = json.Unmarshal(files["subscription.json"], &plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Entitlements != redEntitlements || plan.Subscription == nil || plan.Subscription.Status != "active" {
+		t.Errorf("expected the red plan and its subscription, got %s", files["subscription.json"])
+	}
+
+	var grants []OAuthGrantJson
+	if err = json.Unmarshal(files["oauth_grants.json"], &grants); err != nil {
+		t.Fatal(err)
+	}
+	if len(grants) != 1 || grants[0].ClientName != "Some app" {
+		t.Errorf("expected the grant, got %s", files["oauth_grants.json"])
+	}
+
+	var tokens []PersonalAccessTokenJson
+	if err = json.Unmarshal(files["personal_access_tokens.json"], &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "laptop" {
+		t.Errorf("expected the token, got %s", files["personal_access_tokens.json"])
+	}
+	if bytes.Contains(files["personal_access_tokens.json"], []byte("the hash")) {
+		t.Error("the token's hash is in the export")
+	}
+}
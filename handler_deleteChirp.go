@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/google/uuid"
 )
 
@@ -36,15 +35,8 @@ func (c *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// authenticate the user using their JWT
-	userToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
-		return
-	}
-
-	userID, err := auth.ValidateJWT(userToken, c.secret)
-	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/mailer"
+)
+
+// how long a deactivated account can still be brought back by logging in, DeleteDeactivatedUsers has the same interval
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// how many deletion confirmation emails one user can get per hour
+const maxAccountDeletionEmailsPerHour = 3
+
+// POST /api/users/me/delete-confirmation
+// emails a token that confirms DELETE /api/users/me instead of the password,
+// for users who log in through a provider and never had a password of their own
+func (c *apiConfig) handlerSendDeleteConfirmation(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	recent, err := c.dbQueries.CountRecentAccountDeletionTokens(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if recent >= maxAccountDeletionEmailsPerHour {
+		writeJSONResponse(w, 429, map[string]string{"error": "Too many confirmation emails, try again later"})
+		return
+	}
+
+	token, err := auth.MakeSecureToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate the confirmation token"})
+		return
+	}
+	_, err = c.dbQueries.CreateAccountDeletionToken(r.Context(), database.CreateAccountDeletionTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	err = c.mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm deleting your Chirpy account",
+		Body: fmt.Sprintf("Someone logged in to your Chirpy account asked to delete it.\n\n"+
+			"Send this token as confirmation_token to DELETE /api/users/me within the next hour to confirm:\n\n%s\n\n"+
+			"If it wasn't you, don't send it, and change your login provider's password.", token),
+	})
+	if err != nil {
+		fmt.Printf("Error sending account deletion email: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not send the confirmation email"})
+		return
+	}
+
+	writeJSONResponse(w, 202, map[string]string{"message": "A confirmation token is on its way to your email"})
+}
+
+// DELETE /api/users/me
+// deactivates the account, it is deleted for good after the grace period unless the user logs in again
+func (c *apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	// one of them, see handlerSendDeleteConfirmation
+	type parameters struct {
+		Password          string `json:"password"`
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// NOTE: verifyPassword counts wrong guesses like a login, so a stolen access token can't be used to find the password
+	if params.ConfirmationToken == "" {
+		if _, err = c.verifyPassword(r, user.Email, params.Password); err != nil {
+			writeLoginError(w, err)
+			return
+		}
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	// used up in the same transaction, so it still works if deactivating fails
+	if params.ConfirmationToken != "" {
+		_, err = qtx.ConsumeAccountDeletionToken(r.Context(), database.ConsumeAccountDeletionTokenParams{
+			TokenHash: auth.HashToken(params.ConfirmationToken),
+			UserID:    userID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONResponse(w, 401, map[string]string{"error": "Confirmation token is invalid or has expired"})
+			return
+		}
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+	}
+
+	user, err = qtx.DeactivateUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 409, map[string]string{"error": "Account is already deactivated"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// logged out everywhere, apps and tokens they gave access to included
+	if err = qtx.RevokeAllSessions(r.Context(), userID); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if err = qtx.RevokeAllPersonalAccessTokens(r.Context(), userID); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if err = qtx.RevokeAllOAuthGrants(r.Context(), userID); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	type deleteResponse struct {
+		DeactivatedAt time.Time `json:"deactivated_at"`
+		DeleteAfter   time.Time `json:"delete_after"`
+	}
+	writeJSONResponse(w, 202, deleteResponse{
+		DeactivatedAt: user.DeactivatedAt.Time,
+		DeleteAfter:   user.DeactivatedAt.Time.Add(accountDeletionGracePeriod),
+	})
+}
+
+// deleteDeactivatedUsersJob deletes the accounts whose grace period is over
+func (c *apiConfig) deleteDeactivatedUsersJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deleted, err := c.dbQueries.DeleteDeactivatedUsers(context.Background())
+		if err != nil {
+			fmt.Println("Could not delete deactivated users:", err)
+			continue
+		}
+		if deleted > 0 {
+			fmt.Printf("Deleted %d deactivated users\n", deleted)
+		}
+	}
+}
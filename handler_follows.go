@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type FollowJson struct {
+	UserId uuid.UUID `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+// getOtherUser returns the active user from the {userID} path value, writing a 404 if there is none.
+// Acting on yourself is a 400
+func (c *apiConfig) getOtherUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	otherID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return uuid.Nil, false
+	}
+	if otherID == userID {
+		writeJSONResponse(w, 400, map[string]string{"error": "You can't do that to yourself"})
+		return uuid.Nil, false
+	}
+
+	other, err := c.dbQueries.GetUserByID(r.Context(), otherID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && other.DeactivatedAt.Valid) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return uuid.Nil, false
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return uuid.Nil, false
+	}
+	return otherID, true
+}
+
+// POST /api/users/{userID}/follow
+func (c *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	followeeID, ok := c.getOtherUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	blocked, err := c.dbQueries.IsBlockedEitherWay(r.Context(), database.IsBlockedEitherWayParams{
+		BlockerID: userID,
+		BlockedID: followeeID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if blocked {
+		writeJSONResponse(w, 403, map[string]string{"error": "You can't follow this user"})
+		return
+	}
+
+	followed, err := c.dbQueries.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// only the first follow notifies, following again does nothing
+	if followed > 0 {
+		if err = c.createNotification(r.Context(), followeeID, userID, notificationFollow, uuid.Nil); err != nil {
+			fmt.Printf("Error creating follow notification: %v\n", err)
+		}
+	}
+
+	w.WriteHeader(204)
+}
+
+// DELETE /api/users/{userID}/follow
+func (c *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	unfollowed, err := c.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if unfollowed == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "You don't follow this user"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// GET /api/users/{userID}/followers?limit=20&offset=0
+// newest first
+func (c *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	followers, err := c.dbQueries.GetFollowers(r.Context(), database.GetFollowersParams{
+		FolloweeID: userID,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := []FollowJson{}
+	for _, follower := range followers {
+		response = append(response, FollowJson{UserId: follower.FollowerID, Since: follower.CreatedAt})
+	}
+	writeJSONResponse(w, 200, response)
+}
+
+// GET /api/users/{userID}/following?limit=20&offset=0
+// newest first
+func (c *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	following, err := c.dbQueries.GetFollowing(r.Context(), database.GetFollowingParams{
+		FollowerID: userID,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := []FollowJson{}
+	for _, followee := range following {
+		response = append(response, FollowJson{UserId: followee.FolloweeID, Since: followee.CreatedAt})
+	}
+	writeJSONResponse(w, 200, response)
+}
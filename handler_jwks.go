@@ -0,0 +1,13 @@
+package main
+
+import (
+	"net/http"
+)
+
+// GET /.well-known/jwks.json
+// the public keys access tokens are signed with, so other services can verify them without SECRET
+func (c *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	// NOTE: keep this short, a new key has to be published before it starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSONResponse(w, 200, c.jwtKeys.JWKS())
+}
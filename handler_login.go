@@ -1,19 +1,23 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 func (c *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"` // optional, shown in GET /api/sessions
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
@@ -24,23 +28,47 @@ func (c *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check that the user exist and that the password is correct
-	user, err := c.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	user, err := c.verifyPassword(r, params.Email, params.Password)
 	if err != nil {
-		fmt.Println("Could not find user")
-		writeJSONResponse(w, 401, map[string]string{"error": "Incorrect email or password"})
+		writeLoginError(w, err)
 		return
-
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
-	if err != nil {
-		fmt.Println("Password does not match")
-		writeJSONResponse(w, 401, map[string]string{"error": "Incorrect email or password"})
+	c.completeLogin(w, r, user, params.DeviceName)
+}
+
+// completeLogin is every way of logging in after the user has proven who they are (password, external provider, email link).
+// With 2FA on, that only gets them a challenge to trade for tokens along with a code
+func (c *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	totp, err := c.dbQueries.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if err == nil && totp.EnabledAt.Valid {
+		c.respondWithLoginChallenge(w, r, user, deviceName)
 		return
 	}
 
+	c.respondWithLogin(w, r, user, deviceName)
+}
+
+// respondWithLogin starts a new session for a user that has proven who they are
+func (c *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	// logging in is how a deactivated account is brought back before it is deleted
+	if user.DeactivatedAt.Valid {
+		if err := c.dbQueries.ReactivateUser(r.Context(), user.ID); err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+		fmt.Println("Reactivated user", user.ID)
+	}
+
+	// every login starts a new session (refresh token family)
+	sessionID := uuid.New()
+
 	// generate and respond with the token
-	tokenString, err := auth.MakeJWT(user.ID, c.secret, time.Duration(3600)*time.Second) // NOTE: needs to be multiplied this way in order for it to work
+	tokenString, err := auth.MakeJWT(user.ID, sessionID, user.Role, c.jwtKeys, time.Duration(3600)*time.Second) // NOTE: needs to be multiplied this way in order for it to work
 	if err != nil {
 		fmt.Println("Could not generate token for user")
 		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate token"})
@@ -54,8 +82,12 @@ func (c *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_, err = c.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  rToken,
-		UserID: user.ID,
+		Token:      rToken,
+		UserID:     user.ID,
+		FamilyID:   sessionID,
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		Ip:         clientIP(r),
 	})
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
@@ -63,16 +95,16 @@ func (c *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userResponse := UserJson{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        tokenString,
-		RefreshToken: rToken,
-		IsChirpyRed:  user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Token:         tokenString,
+		RefreshToken:  rToken,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
 	}
 
 	writeJSONResponse(w, 200, userResponse)
-	return
-
 }
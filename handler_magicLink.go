@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/mailer"
+)
+
+// how many login links one address can get per hour
+const maxMagicLinksPerHour = 5
+
+// POST /api/login/magic
+// emails a link that logs in without a password.
+// Always responds 202 right away, the account is looked up and emailed in the background,
+// so neither the response nor how long it takes shows which emails have accounts
+func (c *apiConfig) handlerMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	if c.publicURL == "" {
+		writeJSONResponse(w, 501, map[string]string{"error": "Login links need PUBLIC_URL to be set"})
+		return
+	}
+
+	type parameters struct {
+		Email      string `json:"email"`
+		DeviceName string `json:"device_name"` // optional, shown in GET /api/sessions
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	go c.sendMagicLink(params.Email, params.DeviceName)
+
+	writeJSONResponse(w, 202, map[string]string{"message": "If that email has an account, a login link is on its way"})
+}
+
+// sendMagicLink emails a login link if the email has an account. Nobody is waiting on it, so errors are only logged
+func (c *apiConfig) sendMagicLink(email, deviceName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+	defer cancel()
+
+	user, err := c.dbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	recent, err := c.dbQueries.CountRecentMagicLinkTokens(ctx, user.ID)
+	if err != nil {
+		fmt.Printf("Error counting login links: %v\n", err)
+		return
+	}
+	if recent >= maxMagicLinksPerHour {
+		fmt.Println("Too many login links for", user.ID)
+		return
+	}
+
+	token, err := auth.MakeSecureToken()
+	if err != nil {
+		fmt.Printf("Error generating login link: %v\n", err)
+		return
+	}
+	_, err = c.dbQueries.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash:  auth.HashToken(token),
+		UserID:     user.ID,
+		DeviceName: deviceName,
+	})
+	if err != nil {
+		fmt.Printf("Error saving login link: %v\n", err)
+		return
+	}
+
+	link := strings.TrimSuffix(c.publicURL, "/") + "/api/login/magic/callback?token=" + url.QueryEscape(token)
+	err = c.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Open this link within the next 15 minutes to log in to Chirpy:\n\n%s\n\n"+
+			"It only works once. If it wasn't you, you can ignore this email.", link),
+	})
+	if err != nil {
+		fmt.Printf("Error sending login link email: %v\n", err)
+	}
+}
+
+var magicLinkTemplate = template.Must(template.New("magicLink").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Log in - Chirpy</title>
+</head>
+<body>
+	<h1>Log in to Chirpy</h1>
+	<form method="POST" action="/api/login/magic/callback">
+		<input type="hidden" name="token" value="{{.}}">
+		<button type="submit">Log in</button>
+	</form>
+</body>
+</html>
+`))
+
+// GET /api/login/magic/callback?token=
+// the link from the email. It only shows a button that POSTs the token,
+// so mail scanners that open every link don't use up the login
+func (c *apiConfig) handlerMagicLinkPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the token is in the URL, it should not be sent anywhere else
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(200)
+	magicLinkTemplate.Execute(w, r.URL.Query().Get("token"))
+}
+
+// POST /api/login/magic/callback
+// form encoded token from the login link page, responds like POST /api/login
+func (c *apiConfig) handlerMagicLinkCallback(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not read the form"})
+		return
+	}
+
+	magicLink, err := c.dbQueries.ConsumeMagicLinkToken(r.Context(), auth.HashToken(r.PostForm.Get("token")))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 401, map[string]string{"error": "Login link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), magicLink.UserID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	c.completeLogin(w, r, user, magicLink.DeviceName)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type MessageJson struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationId uuid.UUID `json:"conversation_id"`
+	SenderId       uuid.UUID `json:"sender_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Body           string    `json:"body"`
+}
+
+// A new message as it happens, sent over the websocket gateway to every member
+type LiveMessageJson struct {
+	MemberIds []uuid.UUID `json:"member_ids"`
+	Message   MessageJson `json:"message"`
+}
+
+// POST /api/conversations/{conversationID}/messages
+func (c *apiConfig) handlerPostMessage(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversationID, ok := c.getConversationMember(w, r, userID)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	if params.Body == "" {
+		writeJSONResponse(w, 400, map[string]string{"error": "Message is empty"})
+		return
+	}
+	if len(params.Body) > 1000 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Message is too long"})
+		return
+	}
+
+	// everyone else in the conversation has to still take messages from the sender
+	members, err := c.dbQueries.GetConversationMembers(r.Context(), conversationID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get the conversation"})
+		return
+	}
+	recipients := []uuid.UUID{}
+	for _, member := range members {
+		if member.UserID != userID {
+			recipients = append(recipients, member.UserID)
+		}
+	}
+	if !c.checkCanMessage(w, r, userID, recipients) {
+		return
+	}
+
+	message, err := c.dbQueries.CreateMessage(r.Context(), database.CreateMessageParams{
+		ID:             uuid.New(),
+		ConversationID: conversationID,
+		SenderID:       userID,
+		Body:           params.Body,
+	})
+	if err != nil {
+		fmt.Printf("Error creating message: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to send message"})
+		return
+	}
+
+	// NOTE: these are not critical, the message has already been sent
+	if err = c.dbQueries.TouchConversation(r.Context(), conversationID); err != nil {
+		fmt.Printf("Error updating conversation: %v\n", err)
+	}
+	// sending a message means you have read everything before it
+	err = c.dbQueries.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		fmt.Printf("Error marking conversation as read: %v\n", err)
+	}
+
+	response := MessageJson{
+		ID:             message.ID,
+		ConversationId: message.ConversationID,
+		SenderId:       message.SenderID,
+		CreatedAt:      message.CreatedAt,
+		Body:           message.Body,
+	}
+
+	// push it to every member connected over websocket, on any server instance
+	live := LiveMessageJson{Message: response}
+	for _, member := range members {
+		live.MemberIds = append(live.MemberIds, member.UserID)
+	}
+	payload, err := json.Marshal(live)
+	if err == nil {
+		err = c.dbQueries.NotifyMessage(r.Context(), string(payload))
+	}
+	if err != nil {
+		fmt.Printf("Error sending live message: %v\n", err)
+	}
+
+	writeJSONResponse(w, 201, response)
+}
+
+// GET /api/conversations/{conversationID}/messages?limit=20&offset=0
+// newest first
+func (c *apiConfig) handlerGetMessages(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	conversationID, ok := c.getConversationMember(w, r, userID)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	messages, err := c.dbQueries.GetMessages(r.Context(), database.GetMessagesParams{
+		ConversationID: conversationID,
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		fmt.Printf("Error getting messages: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get the messages"})
+		return
+	}
+
+	response := []MessageJson{}
+	for _, message := range messages {
+		response = append(response, MessageJson{
+			ID:             message.ID,
+			ConversationId: message.ConversationID,
+			SenderId:       message.SenderID,
+			CreatedAt:      message.CreatedAt,
+			Body:           message.Body,
+		})
+	}
+
+	writeJSONResponse(w, 200, response)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Notification types
+// NOTE: chirps can't be replied to, liked or rechirped yet, those get a type once they can
+const (
+	notificationFollow  = "follow"
+	notificationMention = "mention"
+)
+
+var notificationTypes = []string{notificationFollow, notificationMention}
+
+type NotificationJson struct {
+	Type          string      `json:"type"`
+	ChirpId       *uuid.UUID  `json:"chirp_id"`
+	ActorCount    int64       `json:"actor_count"`
+	LatestActorId uuid.UUID   `json:"latest_actor_id"`
+	LatestAt      time.Time   `json:"latest_at"`
+	Unread        bool        `json:"unread"`
+	Ids           []uuid.UUID `json:"ids"` // send these back to POST /api/notifications/read
+}
+
+// A single notification as it happens, sent over the websocket gateway
+type LiveNotificationJson struct {
+	ID        uuid.UUID  `json:"id"`
+	UserId    uuid.UUID  `json:"user_id"`
+	ActorId   uuid.UUID  `json:"actor_id"`
+	Type      string     `json:"type"`
+	ChirpId   *uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// createNotification should be called by anything that interacts with another user or their content.
+// chirpID is uuid.Nil for notifications that are not about a chirp (follows)
+func (c *apiConfig) createNotification(ctx context.Context, userID, actorID uuid.UUID, notificationType string, chirpID uuid.UUID) error {
+	// dont notify people about their own actions, or about people they muted
+	if userID == actorID {
+		return nil
+	}
+	muted, err := c.dbQueries.IsMuted(ctx, database.IsMutedParams{
+		MuterID: userID,
+		MutedID: actorID,
+	})
+	if err != nil {
+		return err
+	}
+	if muted {
+		return nil
+	}
+
+	notification, err := c.dbQueries.CreateNotification(ctx, database.CreateNotificationParams{
+		ID:      uuid.New(),
+		UserID:  userID,
+		ActorID: actorID,
+		Type:    notificationType,
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: chirpID != uuid.Nil},
+	})
+	if err != nil {
+		return err
+	}
+
+	// push it to the user if they are connected over websocket, on any server instance
+	live := LiveNotificationJson{
+		ID:        notification.ID,
+		UserId:    notification.UserID,
+		ActorId:   notification.ActorID,
+		Type:      notification.Type,
+		CreatedAt: notification.CreatedAt,
+	}
+	if notification.ChirpID.Valid {
+		live.ChirpId = &notification.ChirpID.UUID
+	}
+	payload, err := json.Marshal(live)
+	if err == nil {
+		err = c.dbQueries.NotifyNotification(ctx, string(payload))
+	}
+	if err != nil {
+		fmt.Printf("Error sending live notification: %v\n", err)
+	}
+	return nil
+}
+
+// GET /api/notifications?type=mention&limit=20&offset=0
+func (c *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Handle type query
+	notificationType := r.URL.Query().Get("type")
+	if notificationType != "" && !slices.Contains(notificationTypes, notificationType) {
+		writeJSONResponse(w, 400, map[string]string{"error": "Unknown notification type"})
+		return
+	}
+
+	// Handle pagination queries
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	query := database.GetGroupedNotificationsParams{
+		UserID: userID,
+		Type:   notificationType,
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	notifications, err := c.dbQueries.GetGroupedNotifications(r.Context(), query)
+	if err != nil {
+		fmt.Printf("Error getting notifications: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your notifications"})
+		return
+	}
+
+	response := []NotificationJson{}
+	for _, n := range notifications {
+		notification := NotificationJson{
+			Type:          n.Type,
+			ActorCount:    n.ActorCount,
+			LatestActorId: n.LatestActorID,
+			LatestAt:      n.LatestAt,
+			Unread:        n.Unread,
+			Ids:           n.Ids,
+		}
+		if n.ChirpID.Valid {
+			notification.ChirpId = &n.ChirpID.UUID
+		}
+		response = append(response, notification)
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// GET /api/notifications/unread_count
+func (c *apiConfig) handlerUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := c.dbQueries.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not count your notifications"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string]int64{"unread": count})
+}
+
+// POST /api/notifications/read
+// an empty or missing ids list marks everything as read
+func (c *apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Ids []uuid.UUID `json:"ids"`
+	}
+	params := parameters{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&params)
+		if err != nil {
+			writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+			return
+		}
+	}
+
+	var err error
+	if len(params.Ids) == 0 {
+		err = c.dbQueries.MarkAllNotificationsRead(r.Context(), userID)
+	} else {
+		err = c.dbQueries.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID:  userID,
+			Column2: params.Ids,
+		})
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not mark your notifications as read"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
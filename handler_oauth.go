@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// what the consent screen tells the user each scope allows
+// NOTE: apps never get the email or password, those can only be changed after logging in to Chirpy
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileWrite: "Change your settings, like your handle and who can message you",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Authorize {{.ClientName}} - Chirpy</title>
+</head>
+<body>
+	<h1>{{.ClientName}} wants to use your Chirpy account</h1>
+	<p>It will be able to:</p>
+	<ul>
+		{{range .Scopes}}<li>{{.}}</li>{{end}}
+	</ul>
+	{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+	<form method="POST" action="/oauth/authorize">
+		{{range $name, $value := .Hidden}}<input type="hidden" name="{{$name}}" value="{{$value}}">{{end}}
+		<p><label>Email <input type="email" name="email" required></label></p>
+		<p><label>Password <input type="password" name="password" required></label></p>
+		<p><label>Two-factor code (if you use 2FA) <input type="text" name="totp_code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+		<button type="submit" name="action" value="approve">Allow</button>
+		<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+	</form>
+</body>
+</html>
+`))
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Authorization error - Chirpy</title>
+</head>
+<body>
+	<h1>Something is wrong with this authorization request</h1>
+	<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// authorizeRequest is a checked GET or POST /oauth/authorize
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	state         string
+	scopes        []string
+	codeChallenge string
+}
+
+// parseAuthorizeRequest writes the error itself when it returns false.
+// A bad client or redirect_uri is shown to the user, never redirected to, RFC 6749 section 4.1.2.1
+func (c *apiConfig) parseAuthorizeRequest(w http.ResponseWriter, r *http.Request, values url.Values) (authorizeRequest, bool) {
+	req := authorizeRequest{}
+
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		renderOAuthErrorPage(w, "Unknown client_id")
+		return req, false
+	}
+	req.client, err = c.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		renderOAuthErrorPage(w, "Unknown client_id")
+		return req, false
+	}
+
+	req.redirectURI = values.Get("redirect_uri")
+	if !slices.Contains(req.client.RedirectUris, req.redirectURI) {
+		renderOAuthErrorPage(w, "redirect_uri is not registered for this app")
+		return req, false
+	}
+	req.state = values.Get("state")
+
+	// from here on errors go back to the app
+	if values.Get("response_type") != "code" {
+		redirectWithOAuthError(w, r, req, "unsupported_response_type", "Only response_type=code is supported")
+		return req, false
+	}
+
+	req.codeChallenge = values.Get("code_challenge")
+	if req.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		redirectWithOAuthError(w, r, req, "invalid_request", "PKCE with code_challenge_method=S256 is required")
+		return req, false
+	}
+
+	req.scopes = strings.Fields(values.Get("scope"))
+	if len(req.scopes) == 0 {
+		redirectWithOAuthError(w, r, req, "invalid_scope", "Ask for at least one scope")
+		return req, false
+	}
+	for _, scope := range req.scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			redirectWithOAuthError(w, r, req, "invalid_scope", fmt.Sprintf("Unknown scope %s", scope))
+			return req, false
+		}
+	}
+	slices.Sort(req.scopes)
+	req.scopes = slices.Compact(req.scopes)
+
+	return req, true
+}
+
+func renderOAuthErrorPage(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(400)
+	errorTemplate.Execute(w, message)
+}
+
+// redirectBack sends the browser back to the app with the params added to its redirect_uri
+func redirectBack(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	// NOTE: redirect_uri was checked against the registered ones so it always parses
+	u, _ := url.Parse(req.redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func redirectWithOAuthError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code, description string) {
+	redirectBack(w, r, req, url.Values{"error": {code}, "error_description": {description}})
+}
+
+func renderConsent(w http.ResponseWriter, status int, req authorizeRequest, errorMessage string) {
+	scopes := []string{}
+	for _, scope := range req.scopes {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+
+	// the POST has to repeat the whole request since nothing is stored until the user agrees
+	hidden := map[string]string{
+		"response_type":         "code",
+		"client_id":             req.client.ID.String(),
+		"redirect_uri":          req.redirectURI,
+		"state":                 req.state,
+		"scope":                 strings.Join(req.scopes, " "),
+		"code_challenge":        req.codeChallenge,
+		"code_challenge_method": "S256",
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// only Chirpy itself can show this page, so it cant be clickjacked
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	consentTemplate.Execute(w, map[string]any{
+		"ClientName": req.client.Name,
+		"Scopes":     scopes,
+		"Hidden":     hidden,
+		"Error":      errorMessage,
+	})
+}
+
+// GET /oauth/authorize
+// the consent screen
+func (c *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := c.parseAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+	renderConsent(w, 200, req, "")
+}
+
+// POST /oauth/authorize
+// the user signs in on the consent screen and the app gets a code for its token request
+func (c *apiConfig) handlerOAuthApprove(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderOAuthErrorPage(w, "Could not read the form")
+		return
+	}
+
+	req, ok := c.parseAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("action") != "approve" {
+		redirectWithOAuthError(w, r, req, "access_denied", "The user denied access")
+		return
+	}
+
+	// check that the user exist and that the password is correct
+	user, err := c.verifyPassword(r, r.PostForm.Get("email"), r.PostForm.Get("password"))
+	if err != nil {
+		renderConsentLoginError(w, req, err)
+		return
+	}
+	if user.DeactivatedAt.Valid {
+		renderConsent(w, 403, req, "Your account is deactivated, log in to Chirpy to get it back first")
+		return
+	}
+
+	// NOTE: only authenticator codes work here, recovery codes are for logging in
+	totp, err := c.dbQueries.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		renderConsent(w, 500, req, "Something went wrong, try again")
+		return
+	}
+	// NOTE: wrong codes count towards the same lockout as POST /api/login/2fa
+	if err == nil && totp.EnabledAt.Valid {
+		err = c.verifyCode(r, user.ID, func() error {
+			step, valid := auth.ValidateTOTP(totp.Secret, r.PostForm.Get("totp_code"), time.Now())
+			if !valid {
+				return &incorrectCodeError{message: "Incorrect two-factor code"}
+			}
+			used, err := c.dbQueries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+				UserID:       user.ID,
+				LastUsedStep: step,
+			})
+			if err != nil {
+				return err
+			}
+			if used == 0 {
+				return &incorrectCodeError{message: "That code was already used, wait for the next one"}
+			}
+			return nil
+		})
+		if err != nil {
+			renderConsentLoginError(w, req, err)
+			return
+		}
+	}
+
+	code, err := auth.MakeSecureToken()
+	if err != nil {
+		renderConsent(w, 500, req, "Something went wrong, try again")
+		return
+	}
+	err = c.dbQueries.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		GrantID:       uuid.New(),
+		RedirectUri:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+	})
+	if err != nil {
+		fmt.Printf("Error creating authorization code: %v\n", err)
+		renderConsent(w, 500, req, "Something went wrong, try again")
+		return
+	}
+
+	redirectBack(w, r, req, url.Values{"code": {code}})
+}
+
+// renderConsentLoginError is writeLoginError for the consent form, it shows the form again with the error
+func renderConsentLoginError(w http.ResponseWriter, req authorizeRequest, err error) {
+	var locked *loginLockedError
+	var incorrect *incorrectCodeError
+	switch {
+	case errors.Is(err, errIncorrectLogin), errors.As(err, &incorrect):
+		renderConsent(w, 401, req, err.Error())
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", fmt.Sprint(locked.retryAfter))
+		renderConsent(w, 429, req, err.Error())
+	default:
+		fmt.Printf("Error checking the consent login: %v\n", err)
+		renderConsent(w, 500, req, "Something went wrong, try again")
+	}
+}
+
+// writeOAuthError is the error shape from RFC 6749 section 5.2
+func writeOAuthError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, statusCode, map[string]string{"error": code, "error_description": description})
+}
+
+// authenticateClient accepts the client credentials with HTTP Basic or in the form.
+// Public clients only send their client_id
+func (c *apiConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	clientIDString, secret, ok := r.BasicAuth()
+	if !ok {
+		clientIDString = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		return database.OauthClient{}, errors.New("Unknown client")
+	}
+	client, err := c.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("Unknown client")
+	}
+
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errors.New("Incorrect client secret")
+		}
+	}
+	return client, nil
+}
+
+// issueOAuthTokens makes an access token and a refresh token for the grant, the refresh token is saved with qtx
+func (c *apiConfig) issueOAuthTokens(ctx context.Context, qtx *database.Queries, grant database.OauthGrant) (map[string]any, error) {
+	accessToken, err := auth.MakeOAuthJWT(grant.UserID, grant.ID, grant.ClientID, grant.Scopes, c.jwtKeys, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = qtx.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		GrantID:   grant.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(time.Hour.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(grant.Scopes, " "),
+	}, nil
+}
+
+// POST /oauth/token
+// trades an authorization code or a refresh token for tokens
+func (c *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, 400, "invalid_request", "Could not read the form")
+		return
+	}
+
+	client, err := c.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		c.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		c.exchangeOAuthRefreshToken(w, r, client)
+	default:
+		writeOAuthError(w, 400, "unsupported_grant_type", "Use authorization_code or refresh_token")
+	}
+}
+
+func (c *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+
+	code, err := c.dbQueries.ConsumeOAuthAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a code used twice might have been stolen, so the tokens from the first use stop working too
+		used, err := c.dbQueries.GetOAuthAuthorizationCode(r.Context(), codeHash)
+		if err == nil && used.UsedAt.Valid {
+			fmt.Printf("Authorization code reuse detected for client %s, revoking grant %s\n", used.ClientID, used.GrantID)
+			if err = c.dbQueries.RevokeOAuthGrant(r.Context(), used.GrantID); err != nil {
+				fmt.Printf("Error revoking oauth grant: %v\n", err)
+			}
+		}
+		writeOAuthError(w, 400, "invalid_grant", "Code is invalid, used or has expired")
+		return
+	}
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, 400, "invalid_grant", "Code was not issued to this client or redirect_uri")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		writeOAuthError(w, 400, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	grant, err := qtx.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+		ID:       code.GrantID,
+		ClientID: code.ClientID,
+		UserID:   code.UserID,
+		Scopes:   code.Scopes,
+	})
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+
+	response, err := c.issueOAuthTokens(r.Context(), qtx, grant)
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Could not generate tokens")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, 200, response)
+}
+
+// refresh tokens rotate like the ones from /api/refresh, reusing one revokes the whole grant
+func (c *apiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	tokenHash := auth.HashToken(r.PostForm.Get("refresh_token"))
+
+	t, err := c.dbQueries.GetOAuthRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		writeOAuthError(w, 400, "invalid_grant", "Refresh token is invalid")
+		return
+	}
+
+	grant, err := c.dbQueries.GetOAuthGrant(r.Context(), t.GrantID)
+	if err != nil || grant.ClientID != client.ID {
+		writeOAuthError(w, 400, "invalid_grant", "Refresh token is invalid or access was revoked")
+		return
+	}
+
+	if t.UsedAt.Valid {
+		c.revokeOAuthGrant(r, grant)
+		writeOAuthError(w, 400, "invalid_grant", "Refresh token has already been used")
+		return
+	}
+	if !time.Now().Before(t.ExpiresAt) {
+		writeOAuthError(w, 400, "invalid_grant", "Refresh token has expired")
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	// NOTE: no rows means another request rotated it first, which is also reuse
+	used, err := qtx.UseOAuthRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+	if used == 0 {
+		tx.Rollback()
+		c.revokeOAuthGrant(r, grant)
+		writeOAuthError(w, 400, "invalid_grant", "Refresh token has already been used")
+		return
+	}
+
+	response, err := c.issueOAuthTokens(r.Context(), qtx, grant)
+	if err != nil {
+		writeOAuthError(w, 500, "server_error", "Could not generate tokens")
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeOAuthError(w, 500, "server_error", "Error in the db, my bad")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, 200, response)
+}
+
+func (c *apiConfig) revokeOAuthGrant(r *http.Request, grant database.OauthGrant) {
+	fmt.Printf("OAuth refresh token reuse detected for client %s, revoking grant %s\n", grant.ClientID, grant.ID)
+	err := c.dbQueries.RevokeOAuthGrant(r.Context(), grant.ID)
+	if err != nil {
+		fmt.Printf("Error revoking oauth grant: %v\n", err)
+	}
+}
+
+// POST /oauth/revoke
+// RFC 7009, takes an access or refresh token and revokes the grant it came from.
+// Always responds 200 unless the client itself is wrong
+func (c *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, 400, "invalid_request", "Could not read the form")
+		return
+	}
+
+	client, err := c.authenticateClient(r)
+	if err != nil {
+		writeOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	grantID := uuid.Nil
+	if t, err := c.dbQueries.GetOAuthRefreshToken(r.Context(), auth.HashToken(token)); err == nil {
+		grantID = t.GrantID
+	} else if claims, err := auth.ParseJWT(token, c.jwtKeys); err == nil && claims.ClientID == client.ID.String() {
+		grantID, _ = claims.Session()
+	}
+
+	// a client can only revoke its own grants
+	if grantID != uuid.Nil {
+		grant, err := c.dbQueries.GetOAuthGrant(r.Context(), grantID)
+		if err == nil && grant.ClientID == client.ID {
+			if err = c.dbQueries.RevokeOAuthGrant(r.Context(), grant.ID); err != nil {
+				writeOAuthError(w, 503, "temporarily_unavailable", "Could not revoke the token, try again")
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(200)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type OAuthClientJson struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectUris []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"` // no secret, has to rely on PKCE alone
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"client_secret,omitempty"` // only when it is registered
+}
+
+type OAuthGrantJson struct {
+	ID         uuid.UUID `json:"id"`
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func oauthClientResponse(client database.OauthClient) OAuthClientJson {
+	return OAuthClientJson{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectUris: client.RedirectUris,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validRedirectURI only allows https, or plain http back to the same machine for apps running locally
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	if u.Scheme == "https" {
+		return true
+	}
+	host := u.Hostname()
+	return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+// POST /api/oauth/clients
+func (c *apiConfig) handlerPostOAuthClient(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectUris []string `json:"redirect_uris"`
+		Public       bool     `json:"public"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > 100 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Give the app a name of at most 100 characters"})
+		return
+	}
+	if len(params.RedirectUris) == 0 || len(params.RedirectUris) > 10 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Give the app between 1 and 10 redirect_uris"})
+		return
+	}
+	for _, uri := range params.RedirectUris {
+		if !validRedirectURI(uri) {
+			writeJSONResponse(w, 400, map[string]string{"error": fmt.Sprintf("%q is not a valid redirect uri, use https (or http to localhost)", uri)})
+			return
+		}
+	}
+
+	// only the hash of the secret is stored
+	secret := ""
+	secretHash := sql.NullString{}
+	if !params.Public {
+		secret, err = auth.MakeSecureToken()
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Could not generate client secret"})
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := c.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectUris,
+	})
+	if err != nil {
+		fmt.Printf("Error creating oauth client: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := oauthClientResponse(client)
+	response.Secret = secret
+	writeJSONResponse(w, 201, response)
+}
+
+// GET /api/oauth/clients
+// the apps this user registered
+func (c *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	clients, err := c.dbQueries.GetOAuthClientsForUser(r.Context(), userID)
+	if err != nil {
+		fmt.Printf("Error getting oauth clients: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your apps"})
+		return
+	}
+
+	response := []OAuthClientJson{}
+	for _, client := range clients {
+		response = append(response, oauthClientResponse(client))
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// DELETE /api/oauth/clients/{clientID}
+// also revokes every token the app was given
+func (c *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "App not found"})
+		return
+	}
+
+	deleted, err := c.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not delete the app"})
+		return
+	}
+	if deleted == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "App not found"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// GET /api/oauth/grants
+// the apps this user let act for them
+func (c *apiConfig) handlerGetOAuthGrants(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	grants, err := c.dbQueries.GetOAuthGrantsForUser(r.Context(), userID)
+	if err != nil {
+		fmt.Printf("Error getting oauth grants: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your connected apps"})
+		return
+	}
+
+	response := []OAuthGrantJson{}
+	for _, grant := range grants {
+		response = append(response, OAuthGrantJson{
+			ID:         grant.ID,
+			ClientID:   grant.ClientID,
+			ClientName: grant.ClientName,
+			Scopes:     grant.Scopes,
+			CreatedAt:  grant.CreatedAt,
+		})
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// DELETE /api/oauth/grants/{grantID}
+func (c *apiConfig) handlerDeleteOAuthGrant(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	grantID, err := uuid.Parse(r.PathValue("grantID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "Connected app not found"})
+		return
+	}
+
+	revoked, err := c.dbQueries.RevokeOAuthGrantForUser(r.Context(), database.RevokeOAuthGrantForUserParams{
+		ID:     grantID,
+		UserID: userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not revoke the app's access"})
+		return
+	}
+	if revoked == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "Connected app not found"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+// GET /api/login/oidc/{provider}?device_name=
+// sends the browser to the provider's login page
+func (c *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := c.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		writeJSONResponse(w, 404, map[string]string{"error": "Unknown login provider"})
+		return
+	}
+
+	// state ties the callback to this login, nonce ties the ID token to it
+	state, err := auth.MakeSecureToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not start the login"})
+		return
+	}
+	nonce, err := auth.MakeSecureToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not start the login"})
+		return
+	}
+	codeVerifier, err := auth.MakeSecureToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not start the login"})
+		return
+	}
+
+	err = c.dbQueries.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		DeviceName:   r.URL.Query().Get("device_name"),
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, auth.PKCEChallenge(codeVerifier))
+	if err != nil {
+		fmt.Printf("Error reaching login provider %s: %v\n", provider.Name, err)
+		writeJSONResponse(w, 502, map[string]string{"error": "Could not reach the login provider"})
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET /api/login/oidc/{provider}/callback
+// the provider sends the user back here, and they get the same response as POST /api/login
+func (c *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := c.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		writeJSONResponse(w, 404, map[string]string{"error": "Unknown login provider"})
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		writeJSONResponse(w, 401, map[string]string{"error": fmt.Sprintf("Login provider said: %s %s", query.Get("error"), query.Get("error_description"))})
+		return
+	}
+
+	state, err := c.dbQueries.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash: auth.HashToken(query.Get("state")),
+		Provider:  provider.Name,
+	})
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Login is invalid or has expired, try again"})
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier)
+	if err != nil {
+		fmt.Printf("Error exchanging code with %s: %v\n", provider.Name, err)
+		writeJSONResponse(w, 502, map[string]string{"error": "Could not finish logging in with the provider"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), idToken, state.Nonce)
+	if err != nil {
+		fmt.Printf("Invalid ID token from %s: %v\n", provider.Name, err)
+		writeJSONResponse(w, 401, map[string]string{"error": "Could not verify the login"})
+		return
+	}
+
+	user, err := c.userForIdentity(r, provider, claims)
+	if errors.Is(err, errIdentityNotLinkable) {
+		writeJSONResponse(w, 409, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error finding user for %s identity: %v\n", provider.Name, err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	c.completeLogin(w, r, user, state.DeviceName)
+}
+
+var errIdentityNotLinkable = errors.New("Your provider did not confirm your email, or a Chirpy account with it exists but is not verified")
+
+// canLinkIdentity is whether a first login through a provider can have the account with the claimed email.
+// existing is the user that already has the email, nil makes a new user
+func canLinkIdentity(claims *oidc.IDTokenClaims, existing *database.User) bool {
+	// an email the provider has not checked could be anyone's
+	if !claims.EmailVerified || !validEmail(claims.Email) {
+		return false
+	}
+	// whoever signed up with this email never proved it was theirs
+	return existing == nil || existing.EmailVerifiedAt.Valid
+}
+
+// userForIdentity finds the user the external account belongs to.
+// The first time, it is linked to the user with the same email, or a new user is made
+func (c *apiConfig) userForIdentity(r *http.Request, provider *oidc.Provider, claims *oidc.IDTokenClaims) (database.User, error) {
+	identity, err := c.dbQueries.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		// NOTE: not critical, only shown to the user
+		err = c.dbQueries.TouchUserIdentity(r.Context(), database.TouchUserIdentityParams{
+			Provider: provider.Name,
+			Subject:  claims.Subject,
+		})
+		if err != nil {
+			fmt.Printf("Error updating identity last login: %v\n", err)
+		}
+		return c.dbQueries.GetUserByID(r.Context(), identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if !canLinkIdentity(claims, nil) {
+		return database.User{}, errIdentityNotLinkable
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	user, err := qtx.GetUserByEmail(r.Context(), claims.Email)
+	if err == nil && !canLinkIdentity(claims, &user) {
+		return database.User{}, errIdentityNotLinkable
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// NOTE: they log in through the provider, the password is only there because every user needs one
+		password, err := auth.MakeSecureToken()
+		if err != nil {
+			return database.User{}, err
+		}
+		hashedPassword, err := c.passwords.Hash(password)
+		if err != nil {
+			return database.User{}, err
+		}
+		user, err = qtx.CreateUser(r.Context(), database.CreateUserParams{
+			ID:             uuid.New(),
+			Email:          claims.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		user, err = qtx.VerifyEmail(r.Context(), database.VerifyEmailParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = qtx.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, tx.Commit()
+}
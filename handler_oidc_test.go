@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/oidc"
+	"github.com/brayanMuniz/Chirpy/internal/oidc/oidctest"
+)
+
+func TestCanLinkIdentity(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider()
+
+	verifiedUser := &database.User{
+		Email:           "walt@example.com",
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	unverifiedUser := &database.User{Email: "walt@example.com"}
+
+	tests := []struct {
+		name          string
+		emailVerified bool
+		email         string
+		existing      *database.User
+		want          bool
+	}{
+		{"new user", true, "walt@example.com", nil, true},
+		{"verified account", true, "walt@example.com", verifiedUser, true},
+		{"unverified account", true, "walt@example.com", unverifiedUser, false},
+		{"provider did not verify the email", false, "walt@example.com", verifiedUser, false},
+		{"provider did not verify the email, new user", false, "walt@example.com", nil, false},
+		{"invalid email", true, "not an email", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the claims come through the same checks as a real login
+			tokenClaims := idp.Claims("n")
+			tokenClaims["email_verified"] = tt.emailVerified
+			tokenClaims["email"] = tt.email
+			claims, err := provider.VerifyIDToken(context.Background(), idp.Sign(t, tokenClaims), "n")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := canLinkIdentity(claims, tt.existing); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsBeforeLogin(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	c := &apiConfig{oidcProviders: map[string]*oidc.Provider{"test": idp.Provider()}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", c.handlerOIDCCallback)
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"unknown provider", "/api/login/oidc/other/callback?code=x&state=y", 404},
+		{"provider error", "/api/login/oidc/test/callback?error=access_denied&state=y", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
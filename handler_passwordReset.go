@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/mailer"
+)
+
+// how many reset emails one address can get per hour
+const maxPasswordResetsPerHour = 3
+
+// how long emails sent after the response (password resets, magic links) can take
+const backgroundMailTimeout = 30 * time.Second
+
+// POST /api/password/forgot
+// Always responds 202 right away, the account is looked up and emailed in the background,
+// so neither the response nor how long it takes shows which emails have accounts
+func (c *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	go c.sendPasswordReset(params.Email)
+
+	writeJSONResponse(w, 202, map[string]string{"message": "If that email has an account, a reset link is on its way"})
+}
+
+// sendPasswordReset emails a reset token if the email has an account. Nobody is waiting on it, so errors are only logged
+func (c *apiConfig) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+	defer cancel()
+
+	user, err := c.dbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	recent, err := c.dbQueries.CountRecentPasswordResetTokens(ctx, user.ID)
+	if err != nil {
+		fmt.Printf("Error counting password resets: %v\n", err)
+		return
+	}
+	if recent >= maxPasswordResetsPerHour {
+		fmt.Println("Too many password resets for", user.ID)
+		return
+	}
+
+	token, err := auth.MakeSecureToken()
+	if err != nil {
+		fmt.Printf("Error generating reset token: %v\n", err)
+		return
+	}
+	_, err = c.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		fmt.Printf("Error saving reset token: %v\n", err)
+		return
+	}
+
+	err = c.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Send this token with your new password to POST /api/password/reset within the next hour:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", token),
+	})
+	if err != nil {
+		fmt.Printf("Error sending password reset email: %v\n", err)
+	}
+}
+
+// POST /api/password/reset
+func (c *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	resetToken, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 400, map[string]string{"error": "Reset token is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// NOTE: returning here rolls back, so the token can be used again with a better password
+	user, err := qtx.GetUserByID(r.Context(), resetToken.UserID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if !c.checkNewPassword(w, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := c.passwords.Hash(params.Password)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to hash your password"})
+		return
+	}
+
+	err = qtx.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Failed to save your new password"})
+		return
+	}
+
+	// whoever had the old password should not stay logged in
+	err = qtx.RevokeAllSessions(r.Context(), resetToken.UserID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// personal access tokens expire after 30 days unless asked otherwise, and never last more than a year
+const (
+	defaultTokenLifetimeDays = 30
+	maxTokenLifetimeDays     = 365
+)
+
+type PersonalAccessTokenJson struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"` // only when it is made
+}
+
+func personalAccessTokenResponse(token database.PersonalAccessToken) PersonalAccessTokenJson {
+	response := PersonalAccessTokenJson{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if token.LastUsedAt.Valid {
+		response.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return response
+}
+
+// GET /api/tokens
+func (c *apiConfig) handlerGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := c.dbQueries.GetPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		fmt.Printf("Error getting tokens: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your tokens"})
+		return
+	}
+
+	response := []PersonalAccessTokenJson{}
+	for _, token := range tokens {
+		response = append(response, personalAccessTokenResponse(token))
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// POST /api/tokens
+// the token is only in this response, only its hash is stored
+func (c *apiConfig) handlerPostPersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	if params.Name == "" || len(params.Name) > 100 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Give the token a name of at most 100 characters"})
+		return
+	}
+	if len(params.Scopes) == 0 {
+		writeJSONResponse(w, 400, map[string]string{"error": "Give the token at least one scope"})
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			writeJSONResponse(w, 400, map[string]string{"error": fmt.Sprintf("Unknown scope %q", scope)})
+			return
+		}
+	}
+	slices.Sort(params.Scopes)
+	params.Scopes = slices.Compact(params.Scopes)
+
+	if params.ExpiresInDays == 0 {
+		params.ExpiresInDays = defaultTokenLifetimeDays
+	}
+	if params.ExpiresInDays < 1 || params.ExpiresInDays > maxTokenLifetimeDays {
+		writeJSONResponse(w, 400, map[string]string{"error": fmt.Sprintf("expires_in_days must be between 1 and %d", maxTokenLifetimeDays)})
+		return
+	}
+
+	tokenString, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate token"})
+		return
+	}
+
+	token, err := c.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(tokenString),
+		Scopes:    params.Scopes,
+		Days:      int32(params.ExpiresInDays),
+	})
+	if err != nil {
+		fmt.Printf("Error creating token: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	response := personalAccessTokenResponse(token)
+	response.Token = tokenString
+	writeJSONResponse(w, 201, response)
+}
+
+// DELETE /api/tokens/{tokenID}
+func (c *apiConfig) handlerDeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "Token not found"})
+		return
+	}
+
+	revoked, err := c.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not revoke the token"})
+		return
+	}
+	if revoked == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "Token not found"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
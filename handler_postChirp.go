@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
@@ -26,21 +25,25 @@ func (c *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// authenticate the user using their JWT
-	userToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(userToken, c.secret)
+	// only verified accounts can post
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
 	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+		return
+	}
+	if !user.EmailVerifiedAt.Valid {
+		writeJSONResponse(w, 403, map[string]string{"error": "Verify your email before posting"})
 		return
 	}
 
 	// msg too long
-	if len(params.Body) > 140 {
-		writeJSONResponse(w, 400, map[string]string{"error": "Chirp is too long"})
+	maxChirpLength := func(e Entitlements) int { return e.MaxChirpLength }
+	if !checkLimit(w, entitlementsFor(user), "long_chirps", len(params.Body), maxChirpLength, "Chirp is too long") {
 		return
 	}
 
@@ -70,6 +73,37 @@ func (c *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// let everyone streaming chirps know, on every server instance
+	payload, err := json.Marshal(ChirpJson{
+		ID:        chirp.ID,
+		UserId:    chirp.UserID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+	})
+	if err == nil {
+		err = c.dbQueries.NotifyChirp(r.Context(), string(payload))
+	}
+	if err != nil {
+		fmt.Printf("Error notifying chirp stream: %v\n", err)
+	}
+
+	// NOTE: the chirp is posted even if a mention can't be notified
+	if handles := mentionedHandles(chirp.Body); len(handles) > 0 {
+		mentioned, err := c.dbQueries.GetMentionedUsers(r.Context(), database.GetMentionedUsersParams{
+			Handles:  handles,
+			AuthorID: userID,
+		})
+		if err != nil {
+			fmt.Printf("Error finding mentioned users: %v\n", err)
+		}
+		for _, mentionedID := range mentioned {
+			if err = c.createNotification(r.Context(), mentionedID, userID, notificationMention, chirp.ID); err != nil {
+				fmt.Printf("Error creating mention notification: %v\n", err)
+			}
+		}
+	}
+
 	// wrapper
 	type chirpResponse struct {
 		ID        uuid.UUID `json:"id"`
@@ -90,3 +124,16 @@ func (c *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 	return
 
 }
+
+// mentionedHandles returns each valid @handle in the body once, lowercase and without the @
+func mentionedHandles(body string) []string {
+	handles := []string{}
+	for _, word := range strings.Fields(body) {
+		word = strings.TrimRight(strings.ToLower(word), ".,!?;:")
+		handle, ok := strings.CutPrefix(word, "@")
+		if ok && validHandle(handle) && !slices.Contains(handles, handle) {
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
@@ -26,7 +25,15 @@ func (c *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if !validEmail(params.Email) {
+		writeJSONResponse(w, 400, map[string]string{"error": "Invalid email"})
+		return
+	}
+	if !c.checkNewPassword(w, params.Password, params.Email) {
+		return
+	}
+
+	hashedPassword, err := c.passwords.Hash(params.Password)
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Something went wrong"})
 		return
@@ -46,20 +53,27 @@ func (c *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// NOTE: the account is created either way, they can ask for another email with POST /api/users/verify/resend
+	if err = c.sendVerificationEmail(r.Context(), user, user.Email); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+
 	// wrapper
 	type userResponse struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
 	}
 	response := userResponse{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: false,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: false,
+		IsChirpyRed:   false,
 	}
 
 	writeJSONResponse(w, 201, response)
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// who can start conversations with the user and message them
+const (
+	dmsFromEveryone  = "everyone"
+	dmsFromFollowers = "followers" // only people who follow the user
+)
+
+type PreferencesJson struct {
+	DmsFrom string `json:"dms_from"`
+}
+
+// GET /api/users/me/preferences
+func (c *apiConfig) handlerGetPreferences(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	writeJSONResponse(w, 200, PreferencesJson{DmsFrom: user.DmsFrom})
+}
+
+// PUT /api/users/me/preferences
+func (c *apiConfig) handlerUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := PreferencesJson{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+	if !slices.Contains([]string{dmsFromEveryone, dmsFromFollowers}, params.DmsFrom) {
+		writeJSONResponse(w, 400, map[string]string{"error": "dms_from must be everyone or followers"})
+		return
+	}
+
+	user, err := c.dbQueries.SetDmsFrom(r.Context(), database.SetDmsFromParams{
+		ID:      userID,
+		DmsFrom: params.DmsFrom,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	writeJSONResponse(w, 200, PreferencesJson{DmsFrom: user.DmsFrom})
+}
+
+type HandleJson struct {
+	Handle string `json:"handle"`
+}
+
+// handles are 3 to 20 lowercase letters, digits or underscores
+func validHandle(handle string) bool {
+	if len(handle) < 3 || len(handle) > 20 {
+		return false
+	}
+	for _, r := range handle {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// PUT /api/users/me/handle
+// what people write after an @ to mention the user, an empty handle removes it
+func (c *apiConfig) handlerUpdateHandle(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := HandleJson{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+	handle := strings.ToLower(strings.TrimPrefix(params.Handle, "@"))
+	if handle != "" && !validHandle(handle) {
+		writeJSONResponse(w, 400, map[string]string{"error": "handle must be 3 to 20 letters, digits or underscores"})
+		return
+	}
+
+	user, err := c.dbQueries.SetHandle(r.Context(), database.SetHandleParams{
+		ID:     userID,
+		Handle: sql.NullString{String: handle, Valid: handle != ""},
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		writeJSONResponse(w, 409, map[string]string{"error": "That handle is taken"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	writeJSONResponse(w, 200, HandleJson{Handle: user.Handle.String})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	recommendationsTTL = time.Hour
+	maxRecommendations = 50
+)
+
+type RecommendationJson struct {
+	UserId            uuid.UUID `json:"user_id"`
+	FollowedByFriends int64     `json:"followed_by_friends"` // people the user follows who follow them
+	SharedHashtags    int64     `json:"shared_hashtags"`
+	NewFollowers      int64     `json:"new_followers"` // in the last week
+	Score             int64     `json:"score"`
+}
+
+// refreshRecommendations recomputes and caches the suggested accounts for a user
+func (c *apiConfig) refreshRecommendations(ctx context.Context, userID uuid.UUID) error {
+	recommendations, err := c.dbQueries.ComputeRecommendations(ctx, database.ComputeRecommendationsParams{
+		UserID: userID,
+		Limit:  maxRecommendations,
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	if err = qtx.DeleteRecommendations(ctx, userID); err != nil {
+		return err
+	}
+	for _, rec := range recommendations {
+		err = qtx.CreateRecommendation(ctx, database.CreateRecommendationParams{
+			UserID:            userID,
+			RecommendedUserID: rec.RecommendedUserID,
+			FollowedByFriends: rec.FollowedByFriends,
+			SharedHashtags:    rec.SharedHashtags,
+			NewFollowers:      rec.NewFollowers,
+			Score:             rec.Score,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = qtx.UpsertRecommendationCache(ctx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recommendationsJob keeps the cached recommendations of users who asked for them this week from going stale,
+// run it in its own goroutine
+func (c *apiConfig) recommendationsJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		userIDs, err := c.dbQueries.GetStaleRecommendationCaches(ctx)
+		if err != nil {
+			fmt.Println("Could not get stale recommendations:", err)
+			continue
+		}
+		for _, userID := range userIDs {
+			if err := c.refreshRecommendations(ctx, userID); err != nil {
+				fmt.Printf("Could not refresh recommendations for %s: %v\n", userID, err)
+			}
+		}
+	}
+}
+
+// GET /api/users/me/recommendations?limit=20
+func (c *apiConfig) handlerGetRecommendations(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, _, err := parsePagination(r)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+	if limit > maxRecommendations {
+		limit = maxRecommendations
+	}
+
+	// only compute them on the request if they were never computed or the job has fallen behind
+	cache, err := c.dbQueries.GetRecommendationCache(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your recommendations"})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) || time.Since(cache.ComputedAt) > recommendationsTTL {
+		if err := c.refreshRecommendations(r.Context(), userID); err != nil {
+			fmt.Printf("Error computing recommendations: %v\n", err)
+			writeJSONResponse(w, 500, map[string]string{"error": "Could not get your recommendations"})
+			return
+		}
+	}
+
+	// NOTE: not critical, it only keeps the job refreshing them
+	if err = c.dbQueries.TouchRecommendationCache(r.Context(), userID); err != nil {
+		fmt.Printf("Error updating recommendations requested at: %v\n", err)
+	}
+
+	recommendations, err := c.dbQueries.GetRecommendations(r.Context(), database.GetRecommendationsParams{
+		UserID: userID,
+		Limit:  limit,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your recommendations"})
+		return
+	}
+
+	response := []RecommendationJson{}
+	for _, rec := range recommendations {
+		response = append(response, RecommendationJson{
+			UserId:            rec.RecommendedUserID,
+			FollowedByFriends: rec.FollowedByFriends,
+			SharedHashtags:    rec.SharedHashtags,
+			NewFollowers:      rec.NewFollowers,
+			Score:             rec.Score,
+		})
+	}
+
+	writeJSONResponse(w, 200, response)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
@@ -8,6 +10,9 @@ import (
 	"time"
 )
 
+// Every refresh hands out a new refresh token and revokes the one that was used.
+// If an already rotated token shows up again someone else has a copy of it,
+// so every token from that login is revoked and the user has to log in again.
 func (c *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -21,34 +26,90 @@ func (c *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// reuse of a rotated token
+	if t.RevokedAt.Valid && t.ReplacedBy.Valid {
+		c.revokeTokenFamily(r, t)
+		writeJSONResponse(w, 401, map[string]string{"error": "Token has already been used"})
+		return
+	}
+
 	if !time.Now().Before(t.ExpiresAt) || t.RevokedAt.Valid {
 		writeJSONResponse(w, 401, map[string]string{"error": "Token has expired"})
 		return
 	}
 
+	// the role is looked up again, so a changed role shows up by the next refresh
+	user, err := c.dbQueries.GetUserByID(r.Context(), t.UserID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
 	// create a new JWT and return that
-	tokenString, err := auth.MakeJWT(t.UserID, c.secret, time.Duration(3600)*time.Second) // NOTE: needs to be multiplied this way in order for it to work
+	tokenString, err := auth.MakeJWT(t.UserID, t.FamilyID, user.Role, c.jwtKeys, time.Duration(3600)*time.Second) // NOTE: needs to be multiplied this way in order for it to work
 	if err != nil {
 		fmt.Println("Could not generate token for user")
 		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate token"})
 		return
 	}
 
-	// Make refresh token and add it to the database
+	// Make refresh token and swap it with the old one in the database
 	rToken, err := auth.MakeRefreshToken()
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate refresh token"})
 		return
 	}
-	_, err = c.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  rToken,
-		UserID: t.UserID,
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:      rToken,
+		UserID:     t.UserID,
+		FamilyID:   t.FamilyID,
+		DeviceName: t.DeviceName,
+		UserAgent:  r.UserAgent(),
+		Ip:         clientIP(r),
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	_, err = qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      t.Token,
+		ReplacedBy: sql.NullString{String: rToken, Valid: true},
 	})
+	// NOTE: no rows means another request rotated it first, which is also reuse
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		c.revokeTokenFamily(r, t)
+		writeJSONResponse(w, 401, map[string]string{"error": "Token has already been used"})
+		return
+	}
 	if err != nil {
 		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
 		return
 	}
 
-	writeJSONResponse(w, 200, map[string]string{"token": tokenString})
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string]string{"token": tokenString, "refresh_token": rToken})
 	return
 }
+
+func (c *apiConfig) revokeTokenFamily(r *http.Request, t database.RefreshToken) {
+	fmt.Printf("Refresh token reuse detected for user %s, revoking family %s\n", t.UserID, t.FamilyID)
+	err := c.dbQueries.RevokeTokenFamily(r.Context(), t.FamilyID)
+	if err != nil {
+		fmt.Printf("Error revoking token family: %v\n", err)
+	}
+}
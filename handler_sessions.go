@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A session is everything that came from one login: its refresh token family and the access tokens made from it
+type SessionJson struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"` // the session making this request
+}
+
+// GET /api/sessions
+func (c *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, sessionID, ok := c.authenticateSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := c.dbQueries.GetActiveSessions(r.Context(), userID)
+	if err != nil {
+		fmt.Printf("Error getting sessions: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not get your sessions"})
+		return
+	}
+
+	response := []SessionJson{}
+	for _, session := range sessions {
+		response = append(response, SessionJson{
+			ID:         session.FamilyID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			SignedInAt: session.SignedInAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    session.FamilyID == sessionID,
+		})
+	}
+
+	writeJSONResponse(w, 200, response)
+}
+
+// DELETE /api/sessions/{sessionID}
+func (c *apiConfig) handlerDeleteSession(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		writeJSONResponse(w, 404, map[string]string{"error": "Session not found"})
+		return
+	}
+
+	revoked, err := c.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not revoke the session"})
+		return
+	}
+	if revoked == 0 {
+		writeJSONResponse(w, 404, map[string]string{"error": "Session not found"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// POST /api/sessions/revoke-all
+// log out everywhere, including this session
+func (c *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.dbQueries.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not revoke your sessions"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// GET /api/stream/chirps?author_id=...&hashtag=...
+// Server-Sent Events: every new chirp is sent as a "chirp" event with the chirp id as the event id,
+// so a client that reconnects with Last-Event-ID gets what it missed
+func (c *apiConfig) handlerStreamChirps(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONResponse(w, 500, map[string]string{"error": "Streaming is not supported"})
+		return
+	}
+
+	// Handle author_id query
+	var authorID uuid.UUID
+	if author_id := r.URL.Query().Get("author_id"); author_id != "" {
+		parsed_id, err := uuid.Parse(author_id)
+		if err != nil {
+			writeJSONResponse(w, 400, map[string]string{"error": "Invalid author_id"})
+			return
+		}
+		authorID = parsed_id
+	}
+
+	// Handle hashtag query, with or without the #
+	hashtag := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("hashtag"), "#"))
+
+	matches := func(chirp ChirpJson) bool {
+		if authorID != uuid.Nil && chirp.UserId != authorID {
+			return false
+		}
+		if hashtag != "" && !hasHashtag(chirp.Body, hashtag) {
+			return false
+		}
+		return true
+	}
+
+	// subscribe before catching up so nothing posted in between is lost
+	messages, unsubscribe := c.broker.Subscribe("chirps")
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	fmt.Fprintf(w, "retry: 3000\n\n")
+
+	// catch up on anything missed since the last event the client saw
+	sent := map[uuid.UUID]bool{}
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		lastID, err := uuid.Parse(lastEventID)
+		if err == nil {
+			missed, err := c.dbQueries.GetChirpsAfter(r.Context(), lastID)
+			if err != nil {
+				fmt.Printf("Error getting missed chirps: %v\n", err)
+			}
+			for _, chirp := range missed {
+				response := ChirpJson{
+					ID:        chirp.ID,
+					UserId:    chirp.UserID,
+					CreatedAt: chirp.CreatedAt,
+					UpdatedAt: chirp.UpdatedAt,
+					Body:      chirp.Body,
+				}
+				if !matches(response) {
+					continue
+				}
+				writeChirpEvent(w, response)
+				sent[chirp.ID] = true
+			}
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case msg, ok := <-messages:
+			// NOTE: the broker drops us if we fall behind, the client will reconnect with Last-Event-ID
+			if !ok {
+				return
+			}
+			chirp := ChirpJson{}
+			if err := json.Unmarshal(msg, &chirp); err != nil {
+				fmt.Printf("Bad chirp notification: %v\n", err)
+				continue
+			}
+			if sent[chirp.ID] || !matches(chirp) {
+				continue
+			}
+			writeChirpEvent(w, chirp)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeChirpEvent(w http.ResponseWriter, chirp ChirpJson) {
+	dat, err := json.Marshal(chirp)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: chirp\ndata: %s\n\n", chirp.ID, dat)
+}
+
+// hashtag should already be lowercase and without the #
+func hasHashtag(body, hashtag string) bool {
+	for _, word := range strings.Fields(body) {
+		word = strings.TrimRight(strings.ToLower(word), ".,!?;:")
+		if word == "#"+hashtag {
+			return true
+		}
+	}
+	return false
+}
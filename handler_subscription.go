@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type SubscriptionJson struct {
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"` // active, past_due, canceled or lapsed
+	CurrentPeriodEnd time.Time  `json:"current_period_end"`
+	CanceledAt       *time.Time `json:"canceled_at,omitempty"`
+}
+
+// GET /api/users/me/subscription
+// the subscription is changed by Polka's webhooks, this is only for showing it
+func (c *apiConfig) handlerGetSubscription(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	subscription, err := c.dbQueries.GetSubscription(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "You have never subscribed to Chirpy Red"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, SubscriptionJson{
+		Plan:             subscription.Plan,
+		Status:           subscription.Status,
+		CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+		CanceledAt:       nullTimePtr(subscription.CanceledAt),
+	})
+}
+
+// lapseSubscriptionsJob ends the subscriptions whose period is over, and takes Red away from those users
+func (c *apiConfig) lapseSubscriptionsJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		lapsed, err := c.dbQueries.LapseExpiredSubscriptions(context.Background())
+		if err != nil {
+			fmt.Println("Could not lapse expired subscriptions:", err)
+			continue
+		}
+		if len(lapsed) > 0 {
+			fmt.Printf("Lapsed %d Chirpy Red subscriptions\n", len(lapsed))
+		}
+	}
+}
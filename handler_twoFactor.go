@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// how many recovery codes are handed out when 2FA is turned on
+const recoveryCodeCount = 10
+
+// respondWithLoginChallenge is the first step of a login with 2FA on.
+// The challenge only lasts 5 minutes and only allows a few wrong codes
+func (c *apiConfig) respondWithLoginChallenge(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	token, err := auth.MakeSecureToken()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate challenge token"})
+		return
+	}
+	_, err = c.dbQueries.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{
+		TokenHash:  auth.HashToken(token),
+		UserID:     user.ID,
+		DeviceName: deviceName,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string]any{"two_factor_required": true, "challenge_token": token})
+}
+
+// POST /api/login/2fa
+// second step of the login, takes a code from the authenticator app or one of the recovery codes
+func (c *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	if params.Code == "" && params.RecoveryCode == "" {
+		writeJSONResponse(w, 400, map[string]string{"error": "Provide a code or a recovery_code"})
+		return
+	}
+
+	challengeHash := auth.HashToken(params.ChallengeToken)
+	challenge, err := c.dbQueries.AttemptLoginChallenge(r.Context(), challengeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 401, map[string]string{"error": "Challenge is invalid or has expired, log in again"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	totp, err := c.dbQueries.GetTOTP(r.Context(), challenge.UserID)
+	if err != nil || !totp.EnabledAt.Valid {
+		writeJSONResponse(w, 401, map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	// NOTE: a challenge only allows 5 tries, but anyone with the password can get more challenges,
+	// so wrong codes are also counted per account by verifyCode
+	err = c.verifyCode(r, challenge.UserID, func() error {
+		if params.Code != "" {
+			step, valid := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+			if !valid {
+				return &incorrectCodeError{message: "Incorrect code"}
+			}
+			used, err := c.dbQueries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+				UserID:       challenge.UserID,
+				LastUsedStep: step,
+			})
+			if err != nil {
+				return err
+			}
+			if used == 0 {
+				return &incorrectCodeError{message: "That code was already used, wait for the next one"}
+			}
+			return nil
+		}
+
+		used, err := c.dbQueries.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(params.RecoveryCode),
+			UserID:   challenge.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return &incorrectCodeError{message: "Incorrect recovery code"}
+		}
+		return nil
+	})
+	if err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
+	// NOTE: no rows means another request already finished this login
+	consumed, err := c.dbQueries.ConsumeLoginChallenge(r.Context(), challengeHash)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if consumed == 0 {
+		writeJSONResponse(w, 401, map[string]string{"error": "Challenge is invalid or has expired, log in again"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		writeJSONResponse(w, 401, map[string]string{"error": "Could not find user"})
+		return
+	}
+
+	c.respondWithLogin(w, r, user, challenge.DeviceName)
+}
+
+// GET /api/2fa
+func (c *apiConfig) handlerGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	totp, err := c.dbQueries.GetTOTP(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	enabled := err == nil && totp.EnabledAt.Valid
+
+	remaining := int64(0)
+	if enabled {
+		remaining, err = c.dbQueries.CountRecoveryCodes(r.Context(), userID)
+		if err != nil {
+			writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+			return
+		}
+	}
+
+	writeJSONResponse(w, 200, map[string]any{"enabled": enabled, "recovery_codes_remaining": remaining})
+}
+
+// POST /api/2fa/enroll
+// hands out a new secret, 2FA is only turned on once a code from it is confirmed
+func (c *apiConfig) handlerEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not generate secret"})
+		return
+	}
+
+	// no rows means 2FA is already on
+	_, err = c.dbQueries.CreateTOTPSecret(r.Context(), database.CreateTOTPSecretParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 409, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI("Chirpy", user.Email, secret),
+	})
+}
+
+// POST /api/2fa/confirm
+// turns 2FA on and responds with the recovery codes, the only time they can be seen
+func (c *apiConfig) handlerConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	totp, err := c.dbQueries.GetTOTP(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 400, map[string]string{"error": "Start with POST /api/2fa/enroll"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if totp.EnabledAt.Valid {
+		writeJSONResponse(w, 409, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+	if !valid {
+		writeJSONResponse(w, 400, map[string]string{"error": "Incorrect code"})
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	err = qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	codes, err := createRecoveryCodes(r, qtx, userID)
+	if err != nil {
+		fmt.Printf("Error creating recovery codes: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not create recovery codes"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	writeJSONResponse(w, 200, map[string][]string{"recovery_codes": codes})
+}
+
+// createRecoveryCodes replaces any old codes, only the hashes are stored
+func createRecoveryCodes(r *http.Request, qtx *database.Queries, userID uuid.UUID) ([]string, error) {
+	err := qtx.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for range recoveryCodeCount {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashRecoveryCode(code),
+			UserID:   userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// POST /api/2fa/disable
+// needs the password again so a stolen access token cant turn 2FA off
+func (c *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// NOTE: verifyPassword counts wrong guesses like a login, so a stolen access token can't be used to find the password
+	if _, err = c.verifyPassword(r, user.Email, params.Password); err != nil {
+		writeLoginError(w, err)
+		return
+	}
+
+	tx, err := c.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	if err = qtx.DeleteTOTP(r.Context(), userID); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+	if err = qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
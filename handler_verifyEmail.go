@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/mailer"
+)
+
+// how many verification emails one account can get per hour
+const maxVerificationEmailsPerHour = 3
+
+var errTooManyVerificationEmails = errors.New("Too many verification emails, try again later")
+
+// validEmail only accepts a bare address like "a@b.com", not "Name <a@b.com>"
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendVerificationEmail emails a single use token that confirms the user owns the address
+func (c *apiConfig) sendVerificationEmail(ctx context.Context, user database.User, email string) error {
+	recent, err := c.dbQueries.CountRecentEmailVerificationTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if recent >= maxVerificationEmailsPerHour {
+		return errTooManyVerificationEmails
+	}
+
+	token, err := auth.MakeSecureToken()
+	if err != nil {
+		return err
+	}
+	_, err = c.dbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     email,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf("Send this token to POST /api/users/verify within the next 24 hours to confirm this is your email:\n\n%s\n\n"+
+			"If you did not sign up for Chirpy, you can ignore this email.", token),
+	})
+}
+
+// sendVerificationEmailInBackground is sendVerificationEmail for after the response. Nobody is waiting on it, so errors are only logged
+func (c *apiConfig) sendVerificationEmailInBackground(user database.User, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+	defer cancel()
+
+	if err := c.sendVerificationEmail(ctx, user, email); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+}
+
+// POST /api/users/verify
+// confirms the email on signup, or switches the account to a new email once it is confirmed
+func (c *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
+		return
+	}
+
+	verification, err := c.dbQueries.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Verification token is invalid or has expired"})
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), verification.UserID)
+	if err != nil {
+		writeJSONResponse(w, 400, map[string]string{"error": "Verification token is invalid or has expired"})
+		return
+	}
+
+	// the user might have asked for a different email since this one was sent
+	if verification.Email != user.Email && (!user.PendingEmail.Valid || verification.Email != user.PendingEmail.String) {
+		writeJSONResponse(w, 400, map[string]string{"error": "This email is no longer waiting to be verified"})
+		return
+	}
+
+	_, err = c.dbQueries.VerifyEmail(r.Context(), database.VerifyEmailParams{
+		ID:    user.ID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		// NOTE: someone else may have taken the email since the change was requested
+		fmt.Printf("Error verifying email: %v\n", err)
+		writeJSONResponse(w, 409, map[string]string{"error": "Could not verify the email, it may already be in use"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// POST /api/users/verify/resend
+func (c *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	userID, ok := c.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := c.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONResponse(w, 404, map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+		return
+	}
+
+	// a pending change takes priority over the current email
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		writeJSONResponse(w, 400, map[string]string{"error": "Your email is already verified"})
+		return
+	}
+
+	err = c.sendVerificationEmail(r.Context(), user, email)
+	if errors.Is(err, errTooManyVerificationEmails) {
+		writeJSONResponse(w, 429, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not send the verification email"})
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -1,60 +1,264 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/brayanMuniz/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
+// how far a delivery's timestamp can be from now, it is rejected after that even with a good signature
+const webhookTolerance = 5 * time.Minute
+
+// POST /api/polka/webhooks
+// Polka signs every delivery, see auth.VerifyWebhook. Every event is kept in the webhook_events ledger,
+// and an event id is only ever applied once (unless an admin replays it)
 func (c *apiConfig) handlerWebHooks(w http.ResponseWriter, r *http.Request) {
-	// check authorization using the provided api key
-	apiToken, err := auth.GetAPIKey(r.Header)
+	// the signature is over the exact bytes that were sent, so the body is read before decoding
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
-		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not read your request"})
 		return
 	}
 
-	if apiToken != c.polkakey {
-		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+	err = auth.VerifyWebhook(c.polkaSecrets, r.Header.Get("Polka-Timestamp"), r.Header.Get("Polka-Signature"), body, time.Now(), webhookTolerance)
+	if err != nil {
+		writeJSONResponse(w, 401, map[string]string{"error": err.Error()})
 		return
 	}
 
-	type Data struct {
-		UserId string `json:"user_id"`
-	}
-
+	// only what the ledger needs, applyPolkaEvent reads the rest
 	type parameters struct {
+		ID    string `json:"id"`
 		Event string `json:"event"`
-		Data  Data   `json:"data"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	params := parameters{}
 	err = decoder.Decode(&params)
 	if err != nil {
-		writeJSONResponse(w, 500, map[string]string{"error": "Something went wrong"})
+		writeJSONResponse(w, 400, map[string]string{"error": "Could not decode your request"})
 		return
 	}
-
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(204)
+	if params.ID == "" {
+		writeJSONResponse(w, 400, map[string]string{"error": "Event id is missing"})
 		return
 	}
 
-	parsedID, err := uuid.Parse(params.Data.UserId)
+	// NOTE: a retry of an event that failed is already there, and is tried again below
+	_, err = c.dbQueries.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		ID:      params.ID,
+		Source:  polkaSource,
+		Event:   params.Event,
+		Payload: string(body),
+	})
 	if err != nil {
-		w.WriteHeader(404)
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
 		return
 	}
 
-	err = c.dbQueries.UpgradeToChirpyRed(r.Context(), parsedID)
+	// NOTE: a redelivery of an event that was already applied is acknowledged, otherwise Polka keeps retrying it
+	err = c.applyWebhookEvent(r.Context(), polkaSource, params.ID, false)
+	if errors.Is(err, errWebhookEventDone) {
+		fmt.Println("Skipped already processed Polka event", params.ID)
+		w.WriteHeader(204)
+		return
+	}
+	if errors.Is(err, errWebhookUnknownUser) {
+		writeJSONResponse(w, 404, map[string]string{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		w.WriteHeader(404)
+		fmt.Printf("Error applying Polka event %s: %v\n", params.ID, err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not apply the event"})
 		return
 	}
 
 	w.WriteHeader(204)
+}
+
+const polkaSource = "polka"
+
+var (
+	errWebhookEventDone   = errors.New("Event has already been received")
+	errWebhookUnknownUser = errors.New("User not found")
+)
+
+// applyWebhookEvent does what a stored event says, and records how it went in the events ledger.
+// Events that were processed already are only applied again when replay is set
+func (c *apiConfig) applyWebhookEvent(ctx context.Context, source, id string, replay bool) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := c.dbQueries.WithTx(tx)
+
+	event, err := qtx.LockWebhookEvent(ctx, database.LockWebhookEventParams{
+		Source: source,
+		ID:     id,
+	})
+	if err != nil {
+		return err
+	}
+	if !replay && (event.Status == "processed" || event.Status == "ignored") {
+		return errWebhookEventDone
+	}
+
+	var status string
+	switch source {
+	case polkaSource:
+		status, err = applyPolkaEvent(ctx, qtx, []byte(event.Payload))
+	default:
+		err = fmt.Errorf("unknown webhook source %q", source)
+	}
+	if err != nil {
+		// NOTE: outside the transaction, whatever the event did is rolled back but the failure is kept
+		tx.Rollback()
+		failErr := c.dbQueries.FailWebhookEvent(ctx, database.FailWebhookEventParams{
+			Source: source,
+			ID:     id,
+			Error:  sql.NullString{String: err.Error(), Valid: true},
+		})
+		if failErr != nil {
+			fmt.Printf("Error recording failed webhook event: %v\n", failErr)
+		}
+		return err
+	}
+
+	err = qtx.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		Source: source,
+		ID:     id,
+		Status: status,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// defaultRedPlan is the plan for upgrades that don't say which one
+const defaultRedPlan = "red"
+
+// applyPolkaEvent returns "processed", or "ignored" for events Chirpy has no use for.
+// The subscription follows the events, is_chirpy_red is only turned off by lapseSubscriptionsJob
+// once the period that was paid for is over
+func applyPolkaEvent(ctx context.Context, q *database.Queries, payload []byte) (string, error) {
+	type Data struct {
+		UserId           string     `json:"user_id"`
+		Plan             string     `json:"plan"`
+		CurrentPeriodEnd *time.Time `json:"current_period_end"` // optional, 30 days when missing
+	}
+
+	type parameters struct {
+		Event string `json:"event"`
+		Data  Data   `json:"data"`
+	}
+
+	params := parameters{}
+	if err := json.Unmarshal(payload, &params); err != nil {
+		return "", err
+	}
+
+	switch params.Event {
+	case "user.upgraded", "user.renewed", "user.downgraded", "user.payment_failed":
+	default:
+		return "ignored", nil
+	}
 
+	userID, err := uuid.Parse(params.Data.UserId)
+	if err != nil {
+		return "", errWebhookUnknownUser
+	}
+	if _, err = q.GetUserByID(ctx, userID); errors.Is(err, sql.ErrNoRows) {
+		return "", errWebhookUnknownUser
+	} else if err != nil {
+		return "", err
+	}
+
+	periodEnd := sql.NullTime{}
+	if params.Data.CurrentPeriodEnd != nil {
+		// NOTE: the columns are TIMESTAMP without a zone, and hold UTC
+		periodEnd = sql.NullTime{Time: params.Data.CurrentPeriodEnd.UTC(), Valid: true}
+	}
+	plan := params.Data.Plan
+	if plan == "" {
+		plan = defaultRedPlan
+	}
+
+	switch params.Event {
+	case "user.upgraded":
+		_, err = q.StartSubscription(ctx, database.StartSubscriptionParams{
+			UserID:           userID,
+			Plan:             plan,
+			CurrentPeriodEnd: periodEnd,
+		})
+		if err != nil {
+			return "", err
+		}
+		err = q.UpgradeToChirpyRed(ctx, userID)
+
+	case "user.renewed":
+		_, err = q.RenewSubscription(ctx, database.RenewSubscriptionParams{
+			UserID:           userID,
+			CurrentPeriodEnd: periodEnd,
+		})
+		// a renewal for someone who upgraded before subscriptions were kept starts one
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = q.StartSubscription(ctx, database.StartSubscriptionParams{
+				UserID:           userID,
+				Plan:             plan,
+				CurrentPeriodEnd: periodEnd,
+			})
+		}
+		if err != nil {
+			return "", err
+		}
+		// a renewal after the subscription lapsed brings Red back
+		err = q.UpgradeToChirpyRed(ctx, userID)
+
+	case "user.payment_failed":
+		var updated int64
+		updated, err = q.MarkSubscriptionPastDue(ctx, userID)
+		if err == nil && updated == 0 {
+			return "ignored", nil
+		}
+
+	case "user.downgraded":
+		var updated int64
+		updated, err = q.CancelSubscription(ctx, userID)
+		if err == nil && updated == 0 {
+			return "ignored", nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return "processed", nil
+}
+
+// loadPolkaSecrets reads POLKA_WEBHOOK_SECRETS, comma separated. While rotating, both the new and the old secret are set
+func loadPolkaSecrets(secrets string) ([][]byte, error) {
+	keys := [][]byte{}
+	for _, secret := range strings.Split(secrets, ",") {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		if len(secret) < 16 {
+			return nil, errors.New("webhook secrets need at least 16 characters")
+		}
+		keys = append(keys, []byte(secret))
+	}
+	return keys, nil
 }
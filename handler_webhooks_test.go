@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+)
+
+const testPolkaBody = `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`
+
+// polkaRequest is a delivery of body signed with secret, sent now
+func polkaRequest(secret []byte, body string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(body))
+	r.Header.Set("Polka-Timestamp", timestamp)
+	r.Header.Set("Polka-Signature", "v1="+auth.SignWebhook(secret, timestamp, []byte(body)))
+	return r
+}
+
+func TestWebhookRedelivery(t *testing.T) {
+	secret := []byte("f271c81ff7084ee5b99a5091b42d486e")
+
+	// the event is in the ledger and was applied, any other query fails the test
+	apiCfg, db := newFakeDB(t, map[string]fakeQuery{
+		"CreateWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+		"LockWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{"evt_1", polkaSource, "user.upgraded", time.Now(), testPolkaBody, "processed", nil, int64(1), time.Now()}}, nil
+		},
+	})
+	apiCfg.polkaSecrets = [][]byte{secret}
+
+	w := httptest.NewRecorder()
+	apiCfg.handlerWebHooks(w, polkaRequest(secret, testPolkaBody))
+
+	if w.Code != 204 {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body)
+	}
+	if db.Calls("LockWebhookEvent") != 1 {
+		t.Errorf("expected the ledger to be checked")
+	}
+}
+
+func TestWebhookBadSignature(t *testing.T) {
+	// rejected before the ledger, there are no queries
+	apiCfg, _ := newFakeDB(t, map[string]fakeQuery{})
+	apiCfg.polkaSecrets = [][]byte{[]byte("f271c81ff7084ee5b99a5091b42d486e")}
+
+	w := httptest.NewRecorder()
+	apiCfg.handlerWebHooks(w, polkaRequest([]byte("0123456789abcdef0123456789abcdef"), testPolkaBody))
+
+	if w.Code != 401 {
+		t.Fatalf("expected 401, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// The message protocol is documented in the README under "WebSocket Gateway"
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 30 * time.Second // also how often the access token is checked again
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Every message in both directions looks like this
+type wsMessage struct {
+	Type  string          `json:"type"`
+	Token string          `json:"token,omitempty"` // only sent by the client with "auth"
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// GET /api/ws
+func (c *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	// authenticate the user using their JWT
+	// NOTE: browsers cant set headers on a websocket so the token can also be in the query
+	userToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		userToken = r.URL.Query().Get("token")
+	}
+	if userToken == "" {
+		writeJSONResponse(w, 401, map[string]string{"error": "Unathorized"})
+		return
+	}
+
+	userID, _, err := c.validateAccessToken(r.Context(), userToken)
+	if err != nil {
+		writeJSONResponse(w, 401, map[string]string{"error": "Invalid user_id format"})
+		return
+	}
+
+	// subscribe before upgrading so nothing is missed
+	// NOTE: only to this user's topics, so how far behind a socket falls only depends on its own traffic
+	notifications, unsubscribeNotifications := c.broker.Subscribe(userTopic("notifications", userID))
+	defer unsubscribeNotifications()
+	messages, unsubscribeMessages := c.broker.Subscribe(userTopic("messages", userID))
+	defer unsubscribeMessages()
+	timeline, unsubscribeTimeline := c.broker.Subscribe(userTopic("timeline", userID))
+	defer unsubscribeTimeline()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Println("Could not upgrade to websocket:", err)
+		return
+	}
+	defer conn.Close()
+
+	// read from the client in the background, everything is written from this goroutine
+	incoming := make(chan wsMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(incoming)
+		conn.SetReadLimit(4096)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			msg := wsMessage{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(msgType string, data interface{}) error {
+		dat, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(wsMessage{Type: msgType, Data: dat})
+	}
+	closeWith := func(code int, reason string) {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	}
+
+	if err := send("ready", map[string]uuid.UUID{"user_id": userID}); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			switch msg.Type {
+			case "auth":
+				// the client refreshed its access token
+				newUserID, _, err := c.validateAccessToken(r.Context(), msg.Token)
+				if err != nil || newUserID != userID {
+					send("error", map[string]string{"error": "Invalid token"})
+					closeWith(websocket.ClosePolicyViolation, "Invalid token")
+					return
+				}
+				userToken = msg.Token
+				if err := send("auth_ok", struct{}{}); err != nil {
+					return
+				}
+			default:
+				if err := send("error", map[string]string{"error": "Unknown message type"}); err != nil {
+					return
+				}
+			}
+
+		case payload, ok := <-notifications:
+			// NOTE: the broker drops us if we fall behind, the client should reconnect and fetch GET /api/notifications
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "Too slow")
+				return
+			}
+			notification := LiveNotificationJson{}
+			if err := json.Unmarshal(payload, &notification); err != nil {
+				continue
+			}
+			if err := send("notification", notification); err != nil {
+				return
+			}
+
+		case payload, ok := <-messages:
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "Too slow")
+				return
+			}
+			live := LiveMessageJson{}
+			if err := json.Unmarshal(payload, &live); err != nil {
+				continue
+			}
+			if err := send("message", live.Message); err != nil {
+				return
+			}
+
+		case payload, ok := <-timeline:
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "Too slow")
+				return
+			}
+			chirp := ChirpJson{}
+			if err := json.Unmarshal(payload, &chirp); err != nil {
+				continue
+			}
+			if err := send("chirp", chirp); err != nil {
+				return
+			}
+
+		case <-ping.C:
+			// the token (and its session) has to stay valid for the whole connection
+			if _, _, err := c.validateAccessToken(r.Context(), userToken); err != nil {
+				send("error", map[string]string{"error": "Token has expired"})
+				closeWith(websocket.ClosePolicyViolation, "Token has expired")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// userTopic is the broker topic for one user's events of a kind, e.g. notifications:<userID>
+func userTopic(kind string, userID uuid.UUID) string {
+	return kind + ":" + userID.String()
+}
+
+// routeLiveEvent publishes notifications and messages only to the topics of the users they are for.
+// Chirps go to everyone on the chirps topic, and to the home timeline of the author and their followers
+func (c *apiConfig) routeLiveEvent(channel string, payload []byte) []string {
+	switch channel {
+	case "notifications":
+		notification := LiveNotificationJson{}
+		if err := json.Unmarshal(payload, &notification); err != nil {
+			fmt.Println("Dropping unreadable live notification:", err)
+			return nil
+		}
+		return []string{userTopic("notifications", notification.UserId)}
+
+	case "messages":
+		live := LiveMessageJson{}
+		if err := json.Unmarshal(payload, &live); err != nil {
+			fmt.Println("Dropping unreadable live message:", err)
+			return nil
+		}
+		topics := []string{}
+		for _, memberID := range live.MemberIds {
+			topics = append(topics, userTopic("messages", memberID))
+		}
+		return topics
+
+	case "chirps":
+		chirp := ChirpJson{}
+		if err := json.Unmarshal(payload, &chirp); err != nil {
+			fmt.Println("Dropping unreadable live chirp:", err)
+			return nil
+		}
+		topics := []string{channel, userTopic("timeline", chirp.UserId)}
+
+		// NOTE: every server instance looks the followers up, only the ones with them connected deliver it
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		followers, err := c.dbQueries.GetTimelineFollowers(ctx, chirp.UserId)
+		if err != nil {
+			fmt.Println("Could not send a chirp to the timelines of its author's followers:", err)
+			return topics
+		}
+		for _, followerID := range followers {
+			topics = append(topics, userTopic("timeline", followerID))
+		}
+		return topics
+	}
+	return []string{channel}
+}
@@ -2,66 +2,106 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
-func HashPassword(password string) (string, error) {
-	p, err := bcrypt.GenerateFromPassword([]byte(password), 4) // NOTE: Minimum is 4
-	if err != nil {
-		return "", err
-	}
-	return string(p), nil
+// Claims are what Chirpy puts in its access tokens
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`       // the refresh token family (login) the access token came from, or the OAuth grant
+	ClientID  string `json:"client_id,omitempty"` // only on tokens issued to OAuth clients
+	Scope     string `json:"scope,omitempty"`     // space separated, only on tokens issued to OAuth clients
+	Role      string `json:"role,omitempty"`      // only on tokens from a login, the role the user had when it was made. requireRole reads the current one from the db
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		return err
+// sessionID can be uuid.Nil for tokens that do not belong to a login session
+func MakeJWT(userID, sessionID uuid.UUID, role string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Role: role,
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
 	}
-	return nil
+
+	return keys.sign(claims)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+// MakeOAuthJWT is an access token for a third party app, limited to the scopes the user agreed to
+func MakeOAuthJWT(userID, grantID, clientID uuid.UUID, scopes []string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		SessionID: grantID.String(),
+		ClientID:  clientID.String(),
+		Scope:     strings.Join(scopes, " "),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// NOTE: Why []byte?: https://golang-jwt.github.io/jwt/usage/signing_methods/#signing-methods-and-key-types
-	return token.SignedString([]byte(tokenSecret))
+	return keys.sign(claims)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{} // the claims will be filled out from the callback function
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil // returns the "decrypted" key
-	})
+// ParseJWT validates the token and returns all of its claims
+// NOTE: HS256 tokens signed with SECRET are only accepted for an hour after the cutoff the key set has, see checkLegacyClaims
+func ParseJWT(tokenString string, keys *KeySet) (*Claims, error) {
+	claims := &Claims{} // the claims will be filled out from the callback function
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		fmt.Println("Parsing Error:", err)
-		return uuid.Nil, err
+		return nil, err
 	}
 
 	// Not a valid token
-	if claims.Issuer != "chirpy" || !time.Now().Before(claims.ExpiresAt.Time) || !token.Valid {
-		return uuid.Nil, errors.New("401 Unauthorized")
+	if claims.Issuer != "chirpy" || claims.ExpiresAt == nil || !time.Now().Before(claims.ExpiresAt.Time) || !token.Valid {
+		return nil, errors.New("401 Unauthorized")
 	}
 
-	userUUID, err := uuid.Parse(claims.Subject)
+	return claims, nil
+}
+
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	return userUUID, nil
+	return claims.UserID()
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Session returns uuid.Nil if the token has no session
+func (c *Claims) Session() (uuid.UUID, error) {
+	if c.SessionID == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(c.SessionID)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -84,6 +124,11 @@ func GetAPIKey(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeSecureToken()
+}
+
+// MakeSecureToken is a random 32 byte hex encoded string, for anything sent to the user that should be unguessable
+func MakeSecureToken() (string, error) {
 	b := make([]byte, 32)
 	_, err := rand.Read(b)
 	if err != nil {
@@ -91,3 +136,68 @@ func MakeRefreshToken() (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// HashToken is used to store single use tokens, so a leaked database cant be used to take over accounts.
+// Only the hash is stored, the token itself only exists where it was sent (an email, a redirect).
+// The tokens are random so a fast hash is fine here, unlike passwords
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Scopes limit what a personal access token can do, logged in users can do everything.
+// NOTE: no scope covers the email or password, those need a login and the current password
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// Roles are what a user is trusted with, moderators look after other users and admins run Chirpy
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles goes from least to most trusted, every role can do what the ones before it can
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// HasRole reports whether someone with role can do what required is needed for
+func HasRole(role, required string) bool {
+	have := slices.Index(Roles, role)
+	need := slices.Index(Roles, required)
+	return have >= 0 && need >= 0 && have >= need
+}
+
+// VerifyPKCE checks the code_verifier against the S256 code_challenge from the authorization request, RFC 7636
+func VerifyPKCE(verifier, challenge string) bool {
+	// 43 to 128 characters, so it has enough entropy
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// PKCEChallenge is the S256 code_challenge for a code_verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// personal access tokens are told apart from JWTs by their prefix
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeSecureToken()
+	if err != nil {
+		return "", err
+	}
+	return personalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// the example from RFC 7636 Appendix B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("expected the challenge %s, got %s", challenge, got)
+	}
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"RFC 7636 example", verifier, challenge, true},
+		{"wrong challenge", verifier, PKCEChallenge(verifier + "x"), false},
+		{"plain challenge", verifier, verifier, false},
+		{"empty challenge", verifier, "", false},
+		{"empty verifier", "", PKCEChallenge(""), false},
+		{"42 characters", strings.Repeat("a", 42), PKCEChallenge(strings.Repeat("a", 42)), false},
+		{"43 characters", strings.Repeat("a", 43), PKCEChallenge(strings.Repeat("a", 43)), true},
+		{"128 characters", strings.Repeat("a", 128), PKCEChallenge(strings.Repeat("a", 128)), true},
+		{"129 characters", strings.Repeat("a", 129), PKCEChallenge(strings.Repeat("a", 129)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
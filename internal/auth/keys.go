@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one Ed25519 or RSA private key, identified by the kid header of the tokens it signs
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// KeySet holds every key access tokens can be verified with.
+// The first key signs new tokens, the rest are kept until the tokens they signed expire.
+// To rotate, put a new key first and remove the old one an hour later.
+type KeySet struct {
+	keys         []SigningKey
+	legacySecret []byte    // HS256 tokens from before the keys existed, empty to stop accepting them
+	legacyCutoff time.Time // when the keys were deployed, no HS256 token was made after it
+}
+
+// legacyTokenLifetime is how long the HS256 access tokens lasted
+const legacyTokenLifetime = time.Hour
+
+// NewKeySet needs at least one key. legacySecret can be empty, if it is set legacyCutoff must be too
+func NewKeySet(keys []SigningKey, legacySecret string, legacyCutoff time.Time) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("a key set needs at least one key")
+	}
+	if legacySecret != "" && legacyCutoff.IsZero() {
+		return nil, errors.New("the legacy secret needs the time the keys were deployed")
+	}
+	return &KeySet{keys: keys, legacySecret: []byte(legacySecret), legacyCutoff: legacyCutoff}, nil
+}
+
+// LoadKeySet reads PEM encoded PKCS#8 (or PKCS#1 RSA) private keys, the first path is the signing key
+func LoadKeySet(paths []string, legacySecret string, legacyCutoff time.Time) (*KeySet, error) {
+	keys := []SigningKey{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseSigningKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys, legacySecret, legacyCutoff)
+}
+
+// GenerateSigningKey makes a new Ed25519 key, used when no keys are configured
+func GenerateSigningKey() (SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return newSigningKey(private)
+}
+
+func ParseSigningKey(data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM block found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return SigningKey{}, errors.New("unsupported key type")
+	}
+	return newSigningKey(signer)
+}
+
+func newSigningKey(key crypto.Signer) (SigningKey, error) {
+	var method jwt.SigningMethod
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return SigningKey{}, errors.New("RSA keys need at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	default:
+		return SigningKey{}, errors.New("only Ed25519 and RSA keys are supported")
+	}
+
+	// the kid is derived from the public key so the same file always gets the same id
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	sum := sha256.Sum256(der)
+	return SigningKey{ID: hex.EncodeToString(sum[:8]), Method: method, Key: key}, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := ks.keys[0]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Key)
+}
+
+// keyFunc picks the verification key from the kid header, and only the algorithm that key is for
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if token.Method != jwt.SigningMethodHS256 || len(ks.legacySecret) == 0 {
+			return nil, errors.New("token has no kid")
+		}
+		if err := ks.checkLegacyClaims(token.Claims); err != nil {
+			return nil, err
+		}
+		return ks.legacySecret, nil
+	}
+
+	for _, key := range ks.keys {
+		if key.ID != kid {
+			continue
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("token algorithm does not match its key")
+		}
+		return key.Key.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown kid %q", kid)
+}
+
+// checkLegacyClaims only lets through HS256 tokens that look like the ones made before the keys:
+// made before the cutoff, still within their lifetime of it, and without the claims that came later.
+// Anyone with SECRET can sign one, so they must not be able to claim a role, a session or scopes
+func (ks *KeySet) checkLegacyClaims(claims jwt.Claims) error {
+	if !time.Now().Before(ks.legacyCutoff.Add(legacyTokenLifetime)) {
+		return errors.New("HS256 tokens are no longer accepted")
+	}
+
+	c, ok := claims.(*Claims)
+	if !ok {
+		return errors.New("unexpected claims")
+	}
+	if c.Role != "" || c.SessionID != "" || c.ClientID != "" || c.Scope != "" {
+		return errors.New("HS256 token has claims it never had")
+	}
+	if c.IssuedAt == nil || !c.IssuedAt.Before(ks.legacyCutoff) {
+		return errors.New("HS256 token was made after the cutoff")
+	}
+	return nil
+}
+
+// JWK is the public half of a key, RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS is every public key, for anyone that needs to verify Chirpy tokens without being able to make them
+func (ks *KeySet) JWKS() map[string][]JWK {
+	jwks := []JWK{}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+		switch public := key.Key.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		jwks = append(jwks, jwk)
+	}
+	return map[string][]JWK{"keys": jwks}
+}
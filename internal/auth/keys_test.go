@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const legacySecret = "the old SECRET"
+
+func legacyToken(t *testing.T, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(legacySecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseJWTLegacyTokens(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Now().Add(-10 * time.Minute)
+	keys, err := NewKeySet([]SigningKey{key}, legacySecret, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what the tokens from before the keys had
+	registered := func(issuedAt time.Time) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+			Subject:   "2b4b7a5e-4a3b-4c1e-9f5c-6f1d2a3b4c5d",
+		}
+	}
+	before := cutoff.Add(-time.Minute)
+
+	tests := []struct {
+		name   string
+		claims Claims
+		want   bool
+	}{
+		{"made before the cutoff", Claims{RegisteredClaims: registered(before)}, true},
+		{"made after the cutoff", Claims{RegisteredClaims: registered(cutoff.Add(time.Minute))}, false},
+		{"no iat", Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "chirpy", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}, false},
+		{"with a role", Claims{RegisteredClaims: registered(before), Role: "admin"}, false},
+		{"with a session", Claims{RegisteredClaims: registered(before), SessionID: "2b4b7a5e-4a3b-4c1e-9f5c-6f1d2a3b4c5d"}, false},
+		{"with a client", Claims{RegisteredClaims: registered(before), ClientID: "2b4b7a5e-4a3b-4c1e-9f5c-6f1d2a3b4c5d"}, false},
+		{"with scopes", Claims{RegisteredClaims: registered(before), Scope: "chirps:write"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWT(legacyToken(t, tt.claims), keys)
+			if ok := err == nil; ok != tt.want {
+				t.Errorf("expected accepted to be %v, got error %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseJWTLegacyTokensAfterTheirLifetime(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every token made before the cutoff has expired by now, even one that claims a longer life
+	cutoff := time.Now().Add(-legacyTokenLifetime - time.Minute)
+	keys, err := NewKeySet([]SigningKey{key}, legacySecret, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := legacyToken(t, Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(cutoff.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+	}})
+
+	if _, err := ParseJWT(token, keys); err == nil {
+		t.Error("expected the token to be rejected")
+	}
+}
+
+func TestNewKeySetNeedsLegacyCutoff(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeySet([]SigningKey{key}, legacySecret, time.Time{}); err == nil {
+		t.Error("expected an error without a cutoff")
+	}
+	if _, err := NewKeySet([]SigningKey{key}, "", time.Time{}); err != nil {
+		t.Errorf("expected no cutoff to be needed without a secret, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// Hasher is one password hashing algorithm with the parameters new hashes should use.
+// Every hash carries its algorithm and parameters, so it can be checked after the policy changes
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Matches reports whether the hash was made with this algorithm, with any parameters
+	Matches(hash string) bool
+	Verify(password, hash string) error
+	// Outdated reports whether the hash was made with weaker parameters than this hasher's
+	Outdated(hash string) bool
+}
+
+// Passwords hashes new passwords with the current hasher, and checks hashes from any supported algorithm
+type Passwords struct {
+	current Hasher
+	known   []Hasher
+	dummy   string
+}
+
+func NewPasswords(current Hasher) (*Passwords, error) {
+	p := &Passwords{
+		current: current,
+		known:   []Hasher{current, BcryptHasher{}, Argon2idHasher{}},
+	}
+
+	dummy, err := current.Hash("chirpy-dummy-password")
+	if err != nil {
+		return nil, err
+	}
+	p.dummy = dummy
+	return p, nil
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+// Check returns ErrPasswordMismatch for a wrong password.
+// rehash is true when the password is right but the hash is below the current policy,
+// it should be replaced with Hash(password) while the password is at hand
+func (p *Passwords) Check(password, hash string) (rehash bool, err error) {
+	for _, hasher := range p.known {
+		if !hasher.Matches(hash) {
+			continue
+		}
+		if err = hasher.Verify(password, hash); err != nil {
+			return false, err
+		}
+		return !p.current.Matches(hash) || p.current.Outdated(hash), nil
+	}
+	return false, errors.New("unknown password hash format")
+}
+
+// CheckNothing takes as long as checking a real password, for when there is no user to check
+func (p *Passwords) CheckNothing(password string) {
+	p.current.Verify(password, p.dummy)
+}
+
+// BcryptHasher makes hashes like $2a$12$...
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b BcryptHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b BcryptHasher) Verify(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.Cost
+}
+
+// Argon2idHasher makes hashes in the PHC string format, $argon2id$v=19$m=19456,t=2,p=1$salt$key
+type Argon2idHasher struct {
+	Memory  uint32 // KiB
+	Time    uint32 // iterations
+	Threads uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2idHasher) Matches(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// parseArgon2id returns the parameters, salt and key from a hash
+func parseArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	params := Argon2idHasher{}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+func (a Argon2idHasher) Verify(password, hash string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a Argon2idHasher) Outdated(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	return err != nil || params.Memory < a.Memory || params.Time < a.Time || params.Threads < a.Threads
+}
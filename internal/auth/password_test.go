@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// small parameters so the tests stay fast
+var testArgon2id = Argon2idHasher{Memory: 64, Time: 1, Threads: 1}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hash, err := testArgon2id.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("expected a PHC string with the parameters, got %s", hash)
+	}
+	if !testArgon2id.Matches(hash) {
+		t.Error("expected the hasher to match its own hash")
+	}
+
+	if err = testArgon2id.Verify("correct horse battery staple", hash); err != nil {
+		t.Errorf("expected the password to match, got %v", err)
+	}
+	if err = testArgon2id.Verify("correct horse battery stapler", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected ErrPasswordMismatch, got %v", err)
+	}
+
+	// the parameters come from the hash, not the hasher checking it
+	if err = (Argon2idHasher{Memory: 19456, Time: 2, Threads: 1}).Verify("correct horse battery staple", hash); err != nil {
+		t.Errorf("expected the password to match with other parameters, got %v", err)
+	}
+
+	// every hash has its own salt
+	other, err := testArgon2id.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("expected two hashes of the same password to differ")
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		hash    string
+		want    Argon2idHasher
+		wantErr bool
+	}{
+		{"valid", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$" + key, Argon2idHasher{Memory: 19456, Time: 2, Threads: 1}, false},
+		{"other parameters", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$" + key, Argon2idHasher{Memory: 65536, Time: 3, Threads: 4}, false},
+		{"old version", "$argon2id$v=16$m=19456,t=2,p=1$" + salt + "$" + key, Argon2idHasher{}, true},
+		{"argon2i", "$argon2i$v=19$m=19456,t=2,p=1$" + salt + "$" + key, Argon2idHasher{}, true},
+		{"missing parameters", "$argon2id$v=19$m=19456,t=2$" + salt + "$" + key, Argon2idHasher{}, true},
+		{"missing key", "$argon2id$v=19$m=19456,t=2,p=1$" + salt, Argon2idHasher{}, true},
+		{"bad salt", "$argon2id$v=19$m=19456,t=2,p=1$not base64!$" + key, Argon2idHasher{}, true},
+		{"bad key", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$not base64!", Argon2idHasher{}, true},
+		{"bcrypt", "$2a$12$R9h/cIPz0gi.URNNX3kh2OPST9/PgBkqquzi.Ss7KIUgO2t0jWMUW", Argon2idHasher{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, gotSalt, gotKey, err := parseArgon2id(tt.hash)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", params)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if params != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, params)
+			}
+			if string(gotSalt) != "saltsaltsaltsalt" || len(gotKey) != 29 {
+				t.Errorf("expected the decoded salt and key, got %q and %d bytes", gotSalt, len(gotKey))
+			}
+		})
+	}
+}
+
+func TestArgon2idOutdated(t *testing.T) {
+	hash, err := testArgon2id.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher Argon2idHasher
+		want   bool
+	}{
+		{"same parameters", testArgon2id, false},
+		{"weaker parameters", Argon2idHasher{Memory: 32, Time: 1, Threads: 1}, false},
+		{"more memory", Argon2idHasher{Memory: 128, Time: 1, Threads: 1}, true},
+		{"more iterations", Argon2idHasher{Memory: 64, Time: 2, Threads: 1}, true},
+		{"more threads", Argon2idHasher{Memory: 64, Time: 1, Threads: 2}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.Outdated(hash); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPasswordsCheck(t *testing.T) {
+	passwords, err := NewPasswords(testArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(hasher Hasher) string {
+		t.Helper()
+		h, err := hasher.Hash("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		hash       string
+		wantRehash bool
+		wantErr    error
+	}{
+		{"current argon2id", "password", hash(testArgon2id), false, nil},
+		{"weaker argon2id", "password", hash(Argon2idHasher{Memory: 32, Time: 1, Threads: 1}), true, nil},
+		{"bcrypt", "password", hash(BcryptHasher{Cost: bcrypt.MinCost}), true, nil},
+		{"wrong password for argon2id", "wrong", hash(testArgon2id), false, ErrPasswordMismatch},
+		{"wrong password for bcrypt", "wrong", hash(BcryptHasher{Cost: bcrypt.MinCost}), false, ErrPasswordMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := passwords.Check(tt.password, tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("expected rehash to be %v, got %v", tt.wantRehash, rehash)
+			}
+		})
+	}
+
+	if _, err = passwords.Check("password", "plaintext"); err == nil {
+		t.Error("expected an unknown hash format to fail")
+	}
+}
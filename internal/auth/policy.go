@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordProblem is one rule a new password breaks, Code is for clients and Message for people
+type PasswordProblem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy is what a new password has to pass
+type PasswordPolicy struct {
+	MinLength int // in characters
+	MinScore  int // from PasswordScore
+	Breached  *BreachedPasswords
+}
+
+// bcrypt ignores everything after 72 bytes, and PASSWORD_HASH can always be switched back to it
+const maxPasswordBytes = 72
+
+// Check returns every rule the password breaks, none means it is fine.
+// email is the account's, the password can't be it
+func (p *PasswordPolicy) Check(password, email string) ([]PasswordProblem, error) {
+	problems := []PasswordProblem{}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, PasswordProblem{
+			Code:    "too_short",
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, PasswordProblem{
+			Code:    "too_long",
+			Message: fmt.Sprintf("Password must be at most %d bytes", maxPasswordBytes),
+		})
+	}
+
+	email = strings.ToLower(email)
+	localPart, _, _ := strings.Cut(email, "@")
+	if lower := strings.ToLower(password); email != "" && (lower == email || lower == localPart) {
+		problems = append(problems, PasswordProblem{
+			Code:    "matches_email",
+			Message: "Password can't be your email",
+		})
+	} else if PasswordScore(password, localPart) < p.MinScore {
+		problems = append(problems, PasswordProblem{
+			Code:    "too_weak",
+			Message: "Password is too easy to guess, try a longer one or a few unrelated words",
+		})
+	}
+
+	if p.Breached != nil {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			problems = append(problems, PasswordProblem{
+				Code:    "breached",
+				Message: fmt.Sprintf("Password has been seen %d times in data breaches, pick another one", count),
+			})
+		}
+	}
+	return problems, nil
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	passwords := map[string]bool{}
+	for _, password := range strings.Fields(commonPasswordList) {
+		passwords[password] = true
+	}
+	return passwords
+}()
+
+// keyboard rows and counting, walking along one is as easy to guess as repeating a key
+var sequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"0123456789",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// isCommon checks the password against the common list, also with leetspeak undone and
+// the digits and symbols people add at the end taken off
+func isCommon(lower string) bool {
+	trimmed := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	for _, candidate := range []string{lower, leet.Replace(lower), trimmed, leet.Replace(trimmed)} {
+		if commonPasswords[candidate] {
+			return true
+		}
+	}
+	return false
+}
+
+// follows reports whether b comes right after a on a keyboard row or in counting, either way
+func follows(a, b rune) bool {
+	for _, sequence := range sequences {
+		i := strings.IndexRune(sequence, a)
+		j := strings.IndexRune(sequence, b)
+		if i >= 0 && j >= 0 && (j-i == 1 || i-j == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordScore estimates how hard the password is to guess, from 0 (in a top passwords list)
+// to 4 (very hard), like zxcvbn's score. userInputs (name, email) count as easy to guess.
+// It is rougher than zxcvbn, the bits of every character are added up, but repeats and
+// runs along the keyboard are nearly free
+func PasswordScore(password string, userInputs ...string) int {
+	lower := strings.ToLower(password)
+	if lower == "" || isCommon(lower) {
+		return 0
+	}
+	for _, input := range userInputs {
+		if len(input) >= 3 {
+			lower = strings.ReplaceAll(lower, strings.ToLower(input), "\x00")
+		}
+	}
+
+	var lowers, uppers, digits, symbols, others bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lowers = true
+		case r >= 'A' && r <= 'Z':
+			uppers = true
+		case r >= '0' && r <= '9':
+			digits = true
+		case r < utf8.RuneSelf:
+			symbols = true
+		default:
+			others = true
+		}
+	}
+	pool := 0
+	for _, set := range []struct {
+		used bool
+		size int
+	}{{lowers, 26}, {uppers, 26}, {digits, 10}, {symbols, 33}, {others, 100}} {
+		if set.used {
+			pool += set.size
+		}
+	}
+	charBits := math.Log2(float64(pool))
+
+	bits := 0.0
+	var prev rune = -1
+	for _, r := range lower {
+		switch {
+		case r == 0:
+			// a user input, guessed at once
+			bits += 1
+		case r == prev || follows(prev, r):
+			bits += 1
+		default:
+			bits += charBits
+		}
+		prev = r
+	}
+
+	switch {
+	case bits < 25:
+		return 0
+	case bits < 35:
+		return 1
+	case bits < 45:
+		return 2
+	case bits < 60:
+		return 3
+	}
+	return 4
+}
+
+// BreachedPasswords looks passwords up in a local copy of the Have I Been Pwned range files.
+// The directory has one file per first 5 hex characters of the SHA-1, like 5BAA6.txt, with the
+// rest of each hash and how often it was seen, "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493".
+// Only the prefix picks what is read, the same k-anonymity lookup as the online API
+type BreachedPasswords struct {
+	dir string
+}
+
+func NewBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachedPasswords{dir: dir}, nil
+}
+
+// Count is how many times the password was seen in breaches, 0 if never
+func (b *BreachedPasswords) Count(password string) (int, error) {
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte(password)))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineSuffix, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		var n int
+		if _, err := fmt.Sscan(count, &n); err != nil || n < 1 {
+			// a list without counts still means it was seen
+			n = 1
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
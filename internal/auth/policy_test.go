@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasswordScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		want       int
+	}{
+		{"empty", "", nil, 0},
+		{"common", "password", nil, 0},
+		{"common in capitals", "PASSWORD", nil, 0},
+		{"common with leetspeak and a suffix", "P@ssw0rd!", nil, 0},
+		{"repeated key", "aaaaaaaaaaaaaaaaaaaa", nil, 0},
+		{"run along the alphabet", "abcdefghijklmnop", nil, 0},
+		{"common with digits", "chirpy12", nil, 0},
+		{"short with digits", "kite42", nil, 1},
+		{"name and a year", "brayan2024!", nil, 4},
+		{"name and a year, with the name known", "brayan2024!", []string{"brayan"}, 1},
+		{"a few unrelated words", "correct horse battery staple", nil, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PasswordScore(tt.password, tt.userInputs...); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	breached, err := NewBreachedPasswords("testdata/breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &PasswordPolicy{MinLength: 8, MinScore: 2, Breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"fine", "correct horse battery staple", "user@example.com", []string{}},
+		{"short and weak", "short", "user@example.com", []string{"too_short", "too_weak"}},
+		{"too long", strings.Repeat("correct horse battery staple ", 3), "user@example.com", []string{"too_long"}},
+		{"the email", "User@Example.com", "user@example.com", []string{"matches_email"}},
+		{"the email's local part", "username", "Username@example.com", []string{"matches_email"}},
+		{"the name in the email", "brayan2024!", "brayan@example.com", []string{"too_weak", "breached"}},
+		{"common and breached", "password", "user@example.com", []string{"too_weak", "breached"}},
+		{"breached but strong", "brayan2024!", "user@example.com", []string{"breached"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := policy.Check(tt.password, tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codes := []string{}
+			for _, problem := range problems {
+				codes = append(codes, problem.Code)
+			}
+			if !slices.Equal(codes, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, codes)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordsCount(t *testing.T) {
+	breached, err := NewBreachedPasswords("testdata/breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		// SHA-1 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8, among other suffixes in 5BAA6.txt
+		{"seen with a count", "password", 3861493},
+		// SHA-1 624BA06CF5A1D3841C41AE7CF4379CD31931764D, listed in lowercase without a count
+		{"seen without a count", "brayan2024!", 1},
+		// SHA-1 ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42, there is no ABF7A.txt
+		{"no file for the prefix", "correct horse battery staple", 0},
+		// SHA-1 8BE3C943B1609FFFBFC51AAD666D0A04ADF83C9D, 8BE3C.txt only has other suffixes
+		{"not in the prefix's file", "Password", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := breached.Count(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	if _, err = NewBreachedPasswords("testdata/breached/5BAA6.txt"); err == nil {
+		t.Error("expected a file to be rejected as the directory")
+	}
+}
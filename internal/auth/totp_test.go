@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA1 seed from RFC 6238 Appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// the RFC lists 8 digit codes, a 6 digit code is the last 6 of them
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+			if !ok {
+				t.Fatalf("expected %s to be valid at %d", tt.code, tt.unix)
+			}
+			if want := tt.unix / totpPeriod; step != want {
+				t.Errorf("expected step %d, got %d", want, step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// 1111111111 is step 37037037, its code is 050471
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"same step", 0, true},
+		{"one step later", 30 * time.Second, true},
+		{"one step earlier", -30 * time.Second, true},
+		{"two steps later", 60 * time.Second, false},
+		{"two steps earlier", -60 * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, "050471", now.Add(tt.offset))
+			if ok != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, ok)
+			}
+			// the step is the one the code was made for, not the current one
+			if ok && step != 37037037 {
+				t.Errorf("expected step 37037037, got %d", step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"spaces in the code", rfc6238Secret, "050 471", true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", true},
+		{"wrong code", rfc6238Secret, "050472", false},
+		{"too short", rfc6238Secret, "05047", false},
+		{"too long", rfc6238Secret, "0504710", false},
+		{"empty", rfc6238Secret, "", false},
+		{"invalid secret", "not base32!", "050471", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, ok)
+			}
+		})
+	}
+}
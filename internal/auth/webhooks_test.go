@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := []byte("f271c81ff7084ee5b99a5091b42d486e")
+	oldSecret := []byte("0123456789abcdef0123456789abcdef")
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := "v1=" + SignWebhook(secret, timestamp, body)
+
+	tests := []struct {
+		name       string
+		secrets    [][]byte
+		timestamp  string
+		signatures string
+		body       []byte
+		want       error
+	}{
+		{"valid", [][]byte{secret}, timestamp, signature, body, nil},
+		{"valid with the old secret still set", [][]byte{oldSecret, secret}, timestamp, signature, body, nil},
+		{"valid among other signatures", [][]byte{secret}, timestamp, "v1=" + SignWebhook(oldSecret, timestamp, body) + ", " + signature, body, nil},
+		{"tampered body", [][]byte{secret}, timestamp, signature, []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"someone else"}}`), ErrWebhookSignature},
+		{"wrong secret", [][]byte{oldSecret}, timestamp, signature, body, ErrWebhookSignature},
+		{"no secrets", nil, timestamp, signature, body, ErrWebhookSignature},
+		{"timestamp changed", [][]byte{secret}, strconv.FormatInt(now.Unix()+1, 10), signature, body, ErrWebhookSignature},
+		{"unknown version", [][]byte{secret}, timestamp, "v2=" + SignWebhook(secret, timestamp, body), body, ErrWebhookSignature},
+		{"not hex", [][]byte{secret}, timestamp, "v1=not hex", body, ErrWebhookSignature},
+		{"missing signature header", [][]byte{secret}, timestamp, "", body, ErrWebhookSignature},
+		{"missing timestamp header", [][]byte{secret}, "", signature, body, ErrWebhookTimestamp},
+		{"timestamp too old", [][]byte{secret}, strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10), signature, body, ErrWebhookTimestamp},
+		{"timestamp too new", [][]byte{secret}, strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10), signature, body, ErrWebhookTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhook(tt.secrets, tt.timestamp, tt.signatures, tt.body, now, 5*time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
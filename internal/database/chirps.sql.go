@@ -59,7 +59,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 
 const getChirp = `-- name: GetChirp :one
 SELECT id, user_id, created_at, updated_at, body FROM chirps 
-WHERE id = $1
+WHERE id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -75,10 +75,48 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	return i, err
 }
 
+const getChirpsAfter = `-- name: GetChirpsAfter :many
+SELECT id, user_id, created_at, updated_at, body FROM chirps
+WHERE created_at > (SELECT c.created_at FROM chirps c WHERE c.id = $1)
+	AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+ORDER BY created_at ASC
+LIMIT 100
+`
+
+func (q *Queries) GetChirpsAfter(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsAfter, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
 SELECT id, user_id, created_at, updated_at, body 
 FROM chirps
 WHERE ($1 = '00000000-0000-0000-0000-000000000000'::UUID OR user_id = $1)
+	AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
 ORDER BY 
     CASE 
         WHEN $2 = 'desc' THEN created_at 
@@ -95,6 +133,7 @@ type GetChirpsParams struct {
 	Column2 interface{}
 }
 
+// chirps of deactivated users are hidden in every query, until they log in again
 func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
 	rows, err := q.db.QueryContext(ctx, getChirps, arg.Column1, arg.Column2)
 	if err != nil {
@@ -123,3 +162,12 @@ func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp,
 	}
 	return items, nil
 }
+
+const notifyChirp = `-- name: NotifyChirp :exec
+SELECT pg_notify('chirps', $1)
+`
+
+func (q *Queries) NotifyChirp(ctx context.Context, payload string) error {
+	_, err := q.db.ExecContext(ctx, notifyChirp, payload)
+	return err
+}
@@ -7,8 +7,10 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -16,7 +18,7 @@ INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
 	$1, NOW(), NOW(), $2, $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
 `
 
 type CreateUserParams struct {
@@ -35,6 +37,39 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const deactivateUser = `-- name: DeactivateUser :one
+UPDATE users
+SET deactivated_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
+`
+
+func (q *Queries) DeactivateUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, deactivateUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
 	)
 	return i, err
 }
@@ -48,8 +83,61 @@ func (q *Queries) DeleteAll(ctx context.Context) error {
 	return err
 }
 
+const deleteDeactivatedUsers = `-- name: DeleteDeactivatedUsers :execrows
+DELETE FROM users
+WHERE deactivated_at < NOW() - INTERVAL '30 days'
+`
+
+// chirps, refresh tokens and everything else of theirs goes with them (ON DELETE CASCADE)
+func (q *Queries) DeleteDeactivatedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDeactivatedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getMentionedUsers = `-- name: GetMentionedUsers :many
+SELECT id FROM users
+WHERE handle = ANY($1::TEXT[]) AND deactivated_at IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = $2 AND blocked_id = users.id)
+			OR (blocker_id = users.id AND blocked_id = $2)
+	)
+`
+
+type GetMentionedUsersParams struct {
+	Handles  []string
+	AuthorID uuid.UUID
+}
+
+// the active users with these handles, leaving out anyone the author blocked or was blocked by
+func (q *Queries) GetMentionedUsers(ctx context.Context, arg GetMentionedUsersParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getMentionedUsers, pq.Array(arg.Handles), arg.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle FROM users
 WHERE email = $1
 `
 
@@ -63,15 +151,185 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const reactivateUser = `-- name: ReactivateUser :exec
+UPDATE users
+SET deactivated_at = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, reactivateUser, id)
+	return err
+}
+
+const setDmsFrom = `-- name: SetDmsFrom :one
+UPDATE users
+SET dms_from = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
+`
+
+type SetDmsFromParams struct {
+	ID      uuid.UUID
+	DmsFrom string
+}
+
+func (q *Queries) SetDmsFrom(ctx context.Context, arg SetDmsFromParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setDmsFrom, arg.ID, arg.DmsFrom)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const setHandle = `-- name: SetHandle :one
+UPDATE users
+SET handle = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
+`
+
+type SetHandleParams struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) SetHandle(ctx context.Context, arg SetHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setHandle, arg.ID, arg.Handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const setPendingEmail = `-- name: SetPendingEmail :exec
+UPDATE users
+SET pending_email = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPendingEmailParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) SetPendingEmail(ctx context.Context, arg SetPendingEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setPendingEmail, arg.ID, arg.PendingEmail)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const updatePassword = `-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updatePassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET email = $2, hashed_password = $3
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
 `
 
 type UpdateUserParams struct {
@@ -90,6 +348,12 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
 	)
 	return i, err
 }
@@ -104,3 +368,37 @@ func (q *Queries) UpgradeToChirpyRed(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, upgradeToChirpyRed, id)
 	return err
 }
+
+const verifyEmail = `-- name: VerifyEmail :one
+UPDATE users
+SET email = $2, email_verified_at = NOW(), updated_at = NOW(),
+	pending_email = CASE WHEN pending_email = $2 THEN NULL ELSE pending_email END
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, pending_email, role, deactivated_at, dms_from, handle
+`
+
+type VerifyEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// also used for email changes, the confirmed address becomes the account's email
+func (q *Queries) VerifyEmail(ctx context.Context, arg VerifyEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeactivatedAt,
+		&i.DmsFrom,
+		&i.Handle,
+	)
+	return i, err
+}
@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Mailer sends emails, swap the implementation with the MAILER env variable
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New picks a mailer from the environment.
+// MAILER=smtp sends through SMTP_ADDR (e.g. a local mailhog), anything else writes files to MAIL_DIR
+func New() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	if os.Getenv("MAILER") == "smtp" {
+		return &SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "./mail"
+	}
+	return &FileMailer{Dir: dir, From: from}
+}
+
+// no new lines in headers, otherwise an email address could add its own headers
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// FileMailer writes every email to its own .eml file so it can be read without a mail server
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	// NOTE: the recipient is in the name so tests and people can find the latest email for someone
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), strings.ReplaceAll(msg.To, string(filepath.Separator), "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o600)
+}
+
+type SMTPMailer struct {
+	Addr     string // host:port
+	From     string
+	Username string // optional
+	Password string
+}
+
+// Send works like smtp.SendMail, but gives up once ctx is done instead of waiting on a slow server
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// NOTE: closing the connection unblocks whatever the client is waiting on
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err = m.deliver(conn, host, msg)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (m *SMTPMailer) deliver(conn net.Conn, host string, msg Message) error {
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(m.From); err != nil {
+		return err
+	}
+	if err = c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(format(m.From, msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,271 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	const nonce = "the nonce"
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			token: func() string { return idp.Sign(t, idp.Claims(nonce)) },
+		},
+		{
+			name: "other issuer",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				claims["iss"] = "https://evil.example.com"
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "other audience",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				claims["aud"] = "some-other-app"
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "more audiences without azp",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				claims["aud"] = []string{oidctest.ClientID, "some-other-app"}
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "more audiences with azp",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				claims["aud"] = []string{oidctest.ClientID, "some-other-app"}
+				claims["azp"] = oidctest.ClientID
+				return idp.Sign(t, claims)
+			},
+		},
+		{
+			name: "other nonce",
+			token: func() string {
+				return idp.Sign(t, idp.Claims("another login's nonce"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "no nonce",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				delete(claims, "nonce")
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				delete(claims, "exp")
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no subject",
+			token: func() string {
+				claims := idp.Claims(nonce)
+				delete(claims, "sub")
+				return idp.Sign(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return oidctest.SignWith(t, otherKey, "not-published", idp.Claims(nonce))
+			},
+			wantErr: true,
+		},
+		{
+			name: "published kid signed by another key",
+			token: func() string {
+				return oidctest.SignWith(t, otherKey, idp.KeyID(), idp.Claims(nonce))
+			},
+			wantErr: true,
+		},
+		{
+			name: "HMAC with a symmetric key",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.Claims(nonce))
+				token.Header["kid"] = "symmetric"
+				signed, err := token.SignedString([]byte("secret"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, idp.Claims(nonce))
+				signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+
+	provider := idp.Provider()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tt.token(), nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, the token was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the token to be accepted: %v", err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "walt@example.com" || !claims.EmailVerified {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider()
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(t, idp.Claims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(t, idp.Claims("n")), "n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := idp.JWKSFetches(); got != 1 {
+		t.Errorf("keys should be cached, fetched %d times", got)
+	}
+
+	// a new kid fetches the keys again
+	idp.RotateKey(t)
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(t, idp.Claims("n")), "n"); err != nil {
+		t.Fatalf("token signed with the rotated key was rejected: %v", err)
+	}
+	if got := idp.JWKSFetches(); got != 2 {
+		t.Errorf("expected the keys to be fetched again after rotation, fetched %d times", got)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	idp.SetDiscoveryIssuer("https://someone-else.example.com")
+	provider := idp.Provider()
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatal("expected discovery with another issuer to fail")
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), idp.Sign(t, idp.Claims("n")), "n"); err == nil {
+		t.Fatal("expected tokens to be rejected when discovery failed")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := oidctest.NewServer(t)
+
+	authURL, err := idp.Provider().AuthCodeURL(context.Background(), "the state", "the nonce", "the challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.URL+"/authorize" {
+		t.Errorf("expected the authorization endpoint, got %s", got)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             oidctest.ClientID,
+		"redirect_uri":          oidctest.RedirectURL,
+		"state":                 "the state",
+		"nonce":                 "the nonce",
+		"code_challenge":        "the challenge",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+	if !strings.Contains(u.Query().Get("scope"), "openid") {
+		t.Errorf("scope should ask for openid, got %q", u.Query().Get("scope"))
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	provider := idp.Provider()
+	idToken := idp.Sign(t, idp.Claims("n"))
+	idp.SetIDToken(idToken)
+
+	got, err := provider.Exchange(context.Background(), oidctest.Code, "the verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != idToken {
+		t.Errorf("expected the ID token from the token endpoint")
+	}
+	if verifier := idp.TokenRequest().Get("code_verifier"); verifier != "the verifier" {
+		t.Errorf("expected the PKCE verifier to be sent, got %q", verifier)
+	}
+
+	if _, err = provider.Exchange(context.Background(), "wrong code", "the verifier"); err == nil {
+		t.Error("expected a rejected code to be an error")
+	}
+
+	idp.SetIDToken("")
+	if _, err = provider.Exchange(context.Background(), oidctest.Code, "the verifier"); err == nil {
+		t.Error("expected a response without an ID token to be an error")
+	}
+}
@@ -0,0 +1,230 @@
+// Package oidctest is a fake identity provider for tests, it serves discovery, JWKS and the token endpoint
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID     = "chirpy"
+	ClientSecret = "client secret"
+	RedirectURL  = "http://localhost:8080/api/login/oidc/test/callback"
+	Code         = "the code" // the only code the token endpoint accepts
+)
+
+// Server is the provider, its issuer is the httptest server's URL
+type Server struct {
+	*httptest.Server
+	Issuer string
+
+	mu              sync.Mutex
+	key             *rsa.PrivateKey
+	kid             string
+	discoveryIssuer string // what discovery claims the issuer is
+	idToken         string // what the token endpoint hands out
+	jwksFetches     int
+	tokenRequest    url.Values // the form of the last token request
+}
+
+// NewServer starts the provider with one RSA signing key, it is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{}
+	s.key, s.kid = newKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("GET /jwks", s.handleJWKS)
+	mux.HandleFunc("POST /token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.URL
+	s.discoveryIssuer = s.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newKey(t testing.TB) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := make([]byte, 8)
+	rand.Read(kid)
+	return key, base64.RawURLEncoding.EncodeToString(kid)
+}
+
+// Provider is a Chirpy provider configured for this server
+func (s *Server) Provider() *oidc.Provider {
+	return &oidc.Provider{
+		Name:         "test",
+		Issuer:       s.Issuer,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  RedirectURL,
+	}
+}
+
+// Claims are valid ID token claims for the nonce, tests change them before signing
+func (s *Server) Claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            s.Issuer,
+		"sub":            "user-1",
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "walt@example.com",
+		"email_verified": true,
+	}
+}
+
+// Sign makes an ID token signed with the current key
+func (s *Server) Sign(t testing.TB, claims jwt.MapClaims) string {
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+	return SignWith(t, key, kid, claims)
+}
+
+// SignWith makes an ID token signed by any key, like one the provider never published
+func SignWith(t testing.TB, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// KeyID is the kid of the current signing key
+func (s *Server) KeyID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kid
+}
+
+// RotateKey replaces the signing key with a new one under a new kid
+func (s *Server) RotateKey(t testing.TB) {
+	key, kid := newKey(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key, s.kid = key, kid
+}
+
+// SetDiscoveryIssuer makes discovery claim another issuer, like a provider pretending to be someone else
+func (s *Server) SetDiscoveryIssuer(issuer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discoveryIssuer = issuer
+}
+
+// SetIDToken is the ID token the token endpoint returns for Code
+func (s *Server) SetIDToken(idToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idToken = idToken
+}
+
+// JWKSFetches is how many times the keys were fetched
+func (s *Server) JWKSFetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jwksFetches
+}
+
+// TokenRequest is the form of the last request to the token endpoint
+func (s *Server) TokenRequest() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequest
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, 200, map[string]string{
+		"issuer":                 s.discoveryIssuer,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwksFetches++
+
+	encode := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, 200, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": s.kid,
+				"use": "sig",
+				"n":   encode(s.key.N.Bytes()),
+				"e":   encode(big.NewInt(int64(s.key.E)).Bytes()),
+			},
+			// keys Chirpy can't use are skipped, not an error
+			{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+		},
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "invalid_request"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenRequest = r.PostForm
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		writeJSON(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+	clientID, _ = url.QueryUnescape(clientID)
+	secret, _ = url.QueryUnescape(secret)
+	if clientID != ClientID || secret != ClientSecret {
+		writeJSON(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	form := r.PostForm
+	if form.Get("grant_type") != "authorization_code" || form.Get("code") != Code ||
+		form.Get("redirect_uri") != RedirectURL || form.Get("code_verifier") == "" {
+		writeJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+		return
+	}
+
+	writeJSON(w, 200, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     s.idToken,
+	})
+}
@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How many messages a subscriber can fall behind before it gets dropped
+const subscriberBuffer = 32
+
+// Broker fans out messages to everyone on this server that subscribed to a topic
+type Broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[string]map[chan []byte]struct{}{}}
+}
+
+// Subscribe returns a channel of messages for the topic and a function to stop listening.
+// If the subscriber is too slow to keep up its channel is closed, so callers should treat
+// a closed channel as "reconnect and catch up".
+func (b *Broker) Subscribe(topic string) (<-chan []byte, func()) {
+	ch := make(chan []byte, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[chan []byte]struct{}{}
+	}
+	b.subs[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[topic][ch]; ok {
+			delete(b.subs[topic], ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Publish never blocks, a full subscriber is dropped instead of slowing everyone else down
+func (b *Broker) Publish(topic string, msg []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- msg:
+		default:
+			delete(b.subs[topic], ch)
+			close(ch)
+		}
+	}
+}
+
+// Router picks the topics a message from a postgres channel is published to, nil drops it
+type Router func(channel string, payload []byte) []string
+
+// Listen uses postgres LISTEN/NOTIFY so that every server instance hears about messages,
+// not just the one that handled the request. route decides which topics get each message,
+// it runs once per message instead of once per subscriber
+func Listen(dbURL string, broker *Broker, route Router, channels ...string) error {
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Println("Listener error:", err)
+		}
+	})
+
+	for _, channel := range channels {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case n := <-listener.Notify:
+				// NOTE: n is nil when the connection was re-established
+				if n == nil {
+					continue
+				}
+				for _, topic := range route(n.Channel, []byte(n.Extra)) {
+					broker.Publish(topic, []byte(n.Extra))
+				}
+			case <-time.After(90 * time.Second):
+				// make sure the connection is still alive
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Failed logins are counted per account and per IP. After the free attempts every failure
+// locks logins for twice as long as the last one, up to maxLockout
+const (
+	freeAccountFailures = 5
+	freeIPFailures      = 20 // higher since many people can share an IP
+	freeCodeFailures    = 5  // 2FA codes, across every challenge
+	firstLockout        = 30 * time.Second
+	maxLockout          = time.Hour
+)
+
+var errIncorrectLogin = errors.New("Incorrect email or password")
+
+type loginLockedError struct {
+	retryAfter int32 // seconds
+}
+
+func (e *loginLockedError) Error() string {
+	return fmt.Sprintf("Too many failed logins, try again in %d seconds", e.retryAfter)
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+// the 2FA counter is separate from the account's, since a correct password clears that one
+func twoFactorThrottleKey(userID uuid.UUID) string {
+	return "2fa:" + userID.String()
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// lockoutFor is how long to lock after this many failures, 0 while they are still free
+func lockoutFor(failures, free int32) time.Duration {
+	if failures < free {
+		return 0
+	}
+	lockout := firstLockout
+	for i := free; i < failures && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, maxLockout)
+}
+
+// verifyPassword is the password check for every login form.
+// It returns errIncorrectLogin for a wrong email or password, and a *loginLockedError while locked out
+func (c *apiConfig) verifyPassword(r *http.Request, email, password string) (database.User, error) {
+	accountKey := accountThrottleKey(email)
+	ipKey := ipThrottleKey(r)
+
+	// NOTE: emails without an account get locked too, so lockouts dont show which emails have one
+	retryAfter, err := c.dbQueries.GetLoginLockout(r.Context(), []string{accountKey, ipKey})
+	if err != nil {
+		return database.User{}, err
+	}
+	if retryAfter > 0 {
+		return database.User{}, &loginLockedError{retryAfter: retryAfter}
+	}
+
+	var rehash bool
+	user, err := c.dbQueries.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		// so an email without an account takes as long as a wrong password
+		c.passwords.CheckNothing(password)
+	} else {
+		rehash, err = c.passwords.Check(password, user.HashedPassword)
+	}
+	if err != nil {
+		c.recordLoginFailure(r, accountKey, freeAccountFailures)
+		c.recordLoginFailure(r, ipKey, freeIPFailures)
+		return database.User{}, errIncorrectLogin
+	}
+
+	// NOTE: only the account is cleared, otherwise logging in to your own account would reset the IP
+	if err = c.dbQueries.ClearLoginThrottle(r.Context(), accountKey); err != nil {
+		fmt.Printf("Error clearing login failures: %v\n", err)
+	}
+	if rehash {
+		c.upgradePasswordHash(r, user, password)
+	}
+	return user, nil
+}
+
+// incorrectCodeError is a wrong or reused 2FA code, the message is shown to the user
+type incorrectCodeError struct {
+	message string
+}
+
+func (e *incorrectCodeError) Error() string {
+	return e.message
+}
+
+// verifyCode runs check, the 2FA code check of a login form, behind its own lockout.
+// check returns an *incorrectCodeError for a wrong code, those are counted per account and per IP.
+// NOTE: the count survives new challenges and correct passwords, only a correct code clears it
+func (c *apiConfig) verifyCode(r *http.Request, userID uuid.UUID, check func() error) error {
+	codeKey := twoFactorThrottleKey(userID)
+	ipKey := ipThrottleKey(r)
+
+	retryAfter, err := c.dbQueries.GetLoginLockout(r.Context(), []string{codeKey, ipKey})
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &loginLockedError{retryAfter: retryAfter}
+	}
+
+	err = check()
+	var incorrect *incorrectCodeError
+	if errors.As(err, &incorrect) {
+		c.recordLoginFailure(r, codeKey, freeCodeFailures)
+		c.recordLoginFailure(r, ipKey, freeIPFailures)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = c.dbQueries.ClearLoginThrottle(r.Context(), codeKey); err != nil {
+		fmt.Printf("Error clearing 2FA failures: %v\n", err)
+	}
+	return nil
+}
+
+// upgradePasswordHash redoes the hash with the current settings, the login works either way
+func (c *apiConfig) upgradePasswordHash(r *http.Request, user database.User, password string) {
+	hashedPassword, err := c.passwords.Hash(password)
+	if err != nil {
+		fmt.Printf("Error rehashing password: %v\n", err)
+		return
+	}
+	err = c.dbQueries.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		fmt.Printf("Error saving rehashed password: %v\n", err)
+	}
+}
+
+func (c *apiConfig) recordLoginFailure(r *http.Request, key string, free int32) {
+	failures, err := c.dbQueries.RecordLoginFailure(r.Context(), key)
+	if err != nil {
+		fmt.Printf("Error recording login failure: %v\n", err)
+		return
+	}
+
+	lockout := lockoutFor(failures, free)
+	if lockout == 0 {
+		return
+	}
+	fmt.Printf("Locking logins for %s for %v after %d failures\n", key, lockout, failures)
+	err = c.dbQueries.LockLogin(r.Context(), database.LockLoginParams{
+		Key:  key,
+		Secs: lockout.Seconds(),
+	})
+	if err != nil {
+		fmt.Printf("Error locking logins: %v\n", err)
+	}
+}
+
+// writeLoginError writes the response for an error from verifyPassword or verifyCode
+func writeLoginError(w http.ResponseWriter, err error) {
+	var locked *loginLockedError
+	var incorrect *incorrectCodeError
+	switch {
+	case errors.Is(err, errIncorrectLogin), errors.As(err, &incorrect):
+		writeJSONResponse(w, 401, map[string]string{"error": err.Error()})
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", fmt.Sprint(locked.retryAfter))
+		writeJSONResponse(w, 429, map[string]string{"error": locked.Error()})
+	default:
+		writeJSONResponse(w, 500, map[string]string{"error": "Error in the db, my bad"})
+	}
+}
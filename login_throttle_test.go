@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		failures int32
+		free     int32
+		want     time.Duration
+	}{
+		{0, freeAccountFailures, 0},
+		{4, freeAccountFailures, 0},
+		{5, freeAccountFailures, 30 * time.Second},
+		{6, freeAccountFailures, time.Minute},
+		{7, freeAccountFailures, 2 * time.Minute},
+		{11, freeAccountFailures, 32 * time.Minute},
+		{12, freeAccountFailures, time.Hour},
+		{1000, freeAccountFailures, time.Hour},
+		{19, freeIPFailures, 0},
+		{20, freeIPFailures, 30 * time.Second},
+		{21, freeIPFailures, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := lockoutFor(tt.failures, tt.free); got != tt.want {
+			t.Errorf("lockoutFor(%d, %d): expected %v, got %v", tt.failures, tt.free, tt.want, got)
+		}
+	}
+}
+
+// loginThrottles keeps the login_throttles table in memory, for the throttle queries of a fakeDB
+type loginThrottles struct {
+	mu          sync.Mutex
+	failures    map[string]int64
+	lockedUntil map[string]time.Time
+}
+
+func newLoginThrottles() *loginThrottles {
+	return &loginThrottles{failures: map[string]int64{}, lockedUntil: map[string]time.Time{}}
+}
+
+func (l *loginThrottles) queries() map[string]fakeQuery {
+	return map[string]fakeQuery{
+		"GetLoginLockout": func(args []driver.Value) ([][]driver.Value, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			retryAfter := 0.0
+			for _, key := range fakeTextArray(args[0]) {
+				if until, ok := l.lockedUntil[key]; ok && until.After(time.Now()) {
+					retryAfter = max(retryAfter, math.Ceil(time.Until(until).Seconds()))
+				}
+			}
+			return [][]driver.Value{{int64(retryAfter)}}, nil
+		},
+		"RecordLoginFailure": func(args []driver.Value) ([][]driver.Value, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			key := args[0].(string)
+			l.failures[key]++
+			return [][]driver.Value{{l.failures[key]}}, nil
+		},
+		"LockLogin": func(args []driver.Value) ([][]driver.Value, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.lockedUntil[args[0].(string)] = time.Now().Add(time.Duration(args[1].(float64) * float64(time.Second)))
+			return nil, nil
+		},
+		"ClearLoginThrottle": func(args []driver.Value) ([][]driver.Value, error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			delete(l.failures, args[0].(string))
+			delete(l.lockedUntil, args[0].(string))
+			return nil, nil
+		},
+	}
+}
+
+// unlock is the lockout running out
+func (l *loginThrottles) unlock(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.lockedUntil, key)
+}
+
+func TestVerifyCodeLockout(t *testing.T) {
+	throttles := newLoginThrottles()
+	apiCfg, _ := newFakeDB(t, throttles.queries())
+
+	userID := uuid.New()
+	codeKey := twoFactorThrottleKey(userID)
+	r := httptest.NewRequest("POST", "/api/login/2fa", nil)
+
+	checked := 0
+	wrongCode := func() error {
+		checked++
+		return &incorrectCodeError{message: "Invalid code"}
+	}
+	rightCode := func() error {
+		checked++
+		return nil
+	}
+
+	// the free failures only count
+	var incorrect *incorrectCodeError
+	for i := 1; i <= freeCodeFailures; i++ {
+		if err := apiCfg.verifyCode(r, userID, wrongCode); !errors.As(err, &incorrect) {
+			t.Fatalf("attempt %d: expected an incorrect code, got %v", i, err)
+		}
+	}
+	if checked != freeCodeFailures {
+		t.Fatalf("expected %d checks, got %d", freeCodeFailures, checked)
+	}
+
+	// the last free failure locked the codes, even a right one isn't checked now
+	var locked *loginLockedError
+	err := apiCfg.verifyCode(r, userID, rightCode)
+	if !errors.As(err, &locked) {
+		t.Fatalf("expected a lockout, got %v", err)
+	}
+	if locked.retryAfter < 29 || locked.retryAfter > 30 {
+		t.Errorf("expected to retry after 30 seconds, got %d", locked.retryAfter)
+	}
+	if checked != freeCodeFailures {
+		t.Errorf("the code was checked while locked")
+	}
+
+	// every failure after the lockout doubles it
+	throttles.unlock(codeKey)
+	if err = apiCfg.verifyCode(r, userID, wrongCode); !errors.As(err, &incorrect) {
+		t.Fatalf("expected an incorrect code, got %v", err)
+	}
+	if err = apiCfg.verifyCode(r, userID, rightCode); !errors.As(err, &locked) || locked.retryAfter < 59 || locked.retryAfter > 60 {
+		t.Fatalf("expected to retry after 60 seconds, got %v", err)
+	}
+
+	// a right code clears the account's failures, but not the IP's
+	throttles.unlock(codeKey)
+	if err = apiCfg.verifyCode(r, userID, rightCode); err != nil {
+		t.Fatalf("expected the right code to pass, got %v", err)
+	}
+	if throttles.failures[codeKey] != 0 {
+		t.Errorf("expected the code failures to be cleared, got %d", throttles.failures[codeKey])
+	}
+	if ipFailures := throttles.failures[ipThrottleKey(r)]; ipFailures != freeCodeFailures+1 {
+		t.Errorf("expected %d IP failures, got %d", freeCodeFailures+1, ipFailures)
+	}
+}
+
+func TestVerifyCodeOtherErrors(t *testing.T) {
+	throttles := newLoginThrottles()
+	apiCfg, _ := newFakeDB(t, throttles.queries())
+	userID := uuid.New()
+	r := httptest.NewRequest("POST", "/api/login/2fa", nil)
+
+	// only wrong codes count towards the lockout
+	dbErr := errors.New("db is down")
+	for i := 0; i < freeCodeFailures+1; i++ {
+		if err := apiCfg.verifyCode(r, userID, func() error { return dbErr }); !errors.Is(err, dbErr) {
+			t.Fatalf("expected the check's error, got %v", err)
+		}
+	}
+	if len(throttles.failures) != 0 {
+		t.Errorf("expected no failures, got %v", throttles.failures)
+	}
+}
+
+func TestVerifyPasswordUpgradesBcrypt(t *testing.T) {
+	argon2id := auth.Argon2idHasher{Memory: 64, Time: 1, Threads: 1}
+	passwords, err := auth.NewPasswords(argon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := auth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	savedHash := ""
+	queries := newLoginThrottles().queries()
+	queries["GetUserByEmail"] = func(args []driver.Value) ([][]driver.Value, error) {
+		return [][]driver.Value{{userID.String(), time.Now(), time.Now(), args[0], bcryptHash, false, nil, nil, "user", nil, "everyone", nil}}, nil
+	}
+	queries["UpdatePassword"] = func(args []driver.Value) ([][]driver.Value, error) {
+		savedHash = args[1].(string)
+		return nil, nil
+	}
+	apiCfg, db := newFakeDB(t, queries)
+	apiCfg.passwords = passwords
+	r := httptest.NewRequest("POST", "/api/login", nil)
+
+	if _, err = apiCfg.verifyPassword(r, "user@example.com", "wrong"); !errors.Is(err, errIncorrectLogin) {
+		t.Fatalf("expected an incorrect login, got %v", err)
+	}
+	if db.Calls("UpdatePassword") != 0 {
+		t.Fatal("a wrong password rehashed the hash")
+	}
+
+	if _, err = apiCfg.verifyPassword(r, "user@example.com", "password"); err != nil {
+		t.Fatalf("expected the login to pass, got %v", err)
+	}
+	if !argon2id.Matches(savedHash) || argon2id.Verify("password", savedHash) != nil {
+		t.Errorf("expected the bcrypt hash to be replaced with an argon2id one, got %q", savedHash)
+	}
+}
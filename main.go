@@ -3,36 +3,52 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/brayanMuniz/Chirpy/internal/auth"
 	"github.com/brayanMuniz/Chirpy/internal/database"
+	"github.com/brayanMuniz/Chirpy/internal/mailer"
+	"github.com/brayanMuniz/Chirpy/internal/oidc"
+	"github.com/brayanMuniz/Chirpy/internal/stream"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq" // The underscore tells Go that you're importing it for its side effects, not because you need to use it.
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB // only needed for transactions, use dbQueries for everything else
 	dbQueries      *database.Queries
 	platform       string
-	secret         string
-	polkakey       string
+	publicURL      string // where Chirpy can be reached from a browser, for links in emails
+	jwtKeys        *auth.KeySet
+	passwords      *auth.Passwords
+	passwordPolicy *auth.PasswordPolicy
+	oidcProviders  map[string]*oidc.Provider
+	polkaSecrets   [][]byte
+	broker         *stream.Broker
+	mailer         mailer.Mailer
 }
 
 // Database structs
 type UserJson struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Role          string    `json:"role"`
 }
 
 type ChirpJson struct {
@@ -72,6 +88,26 @@ func writeJSONResponse(w http.ResponseWriter, statusCode int, respBody interface
 	w.Write(dat)
 }
 
+// limit and offset queries, used by every paginated endpoint
+func parsePagination(r *http.Request) (limit int32, offset int32, err error) {
+	limit = 20 // default
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return 0, 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = int32(parsed)
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be a positive number")
+		}
+		offset = int32(parsed)
+	}
+	return limit, offset, nil
+}
+
 func runMigrations(dbURL string) error {
 	cmd := exec.Command("goose", "-dir", "./sql/schema", "postgres", dbURL, "up")
 	cmd.Stdout = os.Stdout
@@ -79,6 +115,86 @@ func runMigrations(dbURL string) error {
 	return cmd.Run()
 }
 
+// loadJWTKeys reads the comma separated key files in JWT_KEYS, the first one signs new tokens.
+// SECRET is only kept to accept the HS256 tokens made before SECRET_CUTOFF, the switch
+func loadJWTKeys() (*auth.KeySet, error) {
+	legacySecret := os.Getenv("SECRET")
+	var legacyCutoff time.Time
+	if legacySecret != "" {
+		var err error
+		legacyCutoff, err = time.Parse(time.RFC3339, os.Getenv("SECRET_CUTOFF"))
+		if err != nil {
+			return nil, fmt.Errorf("SECRET needs SECRET_CUTOFF, when the keys were deployed: %w", err)
+		}
+	}
+
+	paths := os.Getenv("JWT_KEYS")
+	if paths != "" {
+		return auth.LoadKeySet(strings.Split(paths, ","), legacySecret, legacyCutoff)
+	}
+
+	// NOTE: fine for dev, but every restart makes the old access tokens invalid
+	fmt.Println("JWT_KEYS not set, signing with a temporary key")
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewKeySet([]auth.SigningKey{key}, legacySecret, legacyCutoff)
+}
+
+// envInt reads a whole number setting, def when it is not set
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return n, nil
+}
+
+// loadPasswords picks how new passwords are hashed, PASSWORD_HASH is argon2id (default) or bcrypt.
+// Hashes made with another algorithm or weaker settings still work, and are redone on the next login
+func loadPasswords() (*auth.Passwords, error) {
+	switch os.Getenv("PASSWORD_HASH") {
+	case "", "argon2id":
+		// defaults are the OWASP minimum, 19 MiB with 2 passes
+		memory, err := envInt("ARGON2_MEMORY", 19*1024)
+		if err != nil {
+			return nil, err
+		}
+		passes, err := envInt("ARGON2_TIME", 2)
+		if err != nil {
+			return nil, err
+		}
+		threads, err := envInt("ARGON2_THREADS", 1)
+		if err != nil {
+			return nil, err
+		}
+		if threads > 255 {
+			return nil, errors.New("ARGON2_THREADS must be at most 255")
+		}
+		return auth.NewPasswords(auth.Argon2idHasher{
+			Memory:  uint32(memory),
+			Time:    uint32(passes),
+			Threads: uint8(threads),
+		})
+
+	case "bcrypt":
+		cost, err := envInt("BCRYPT_COST", 12)
+		if err != nil {
+			return nil, err
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return auth.NewPasswords(auth.BcryptHasher{Cost: cost})
+	}
+	return nil, errors.New("PASSWORD_HASH must be argon2id or bcrypt")
+}
+
 func main() {
 	godotenv.Load()
 
@@ -101,6 +217,15 @@ func main() {
 		return
 	}
 
+	// chirpy <command> runs the command instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(db, database.New(db), os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	mux := http.NewServeMux() // responsible for handling and routing paths
 	server := http.Server{
 		Addr:    ":8080",
@@ -109,10 +234,58 @@ func main() {
 
 	// apiCfg
 	apiCfg := apiConfig{}
+	apiCfg.db = db
 	apiCfg.dbQueries = database.New(db)
 	apiCfg.platform = os.Getenv("PLATFORM")
-	apiCfg.secret = os.Getenv("SECRET")
-	apiCfg.polkakey = os.Getenv("POLKA_KEY")
+	apiCfg.jwtKeys, err = loadJWTKeys()
+	if err != nil {
+		fmt.Println("Failed to load JWT keys:", err)
+		return
+	}
+	apiCfg.passwords, err = loadPasswords()
+	if err != nil {
+		fmt.Println("Failed to set up password hashing:", err)
+		return
+	}
+	apiCfg.passwordPolicy, err = loadPasswordPolicy()
+	if err != nil {
+		fmt.Println("Failed to load the password policy:", err)
+		return
+	}
+	apiCfg.polkaSecrets, err = loadPolkaSecrets(os.Getenv("POLKA_WEBHOOK_SECRETS"))
+	if err != nil {
+		fmt.Println("Failed to load Polka webhook secrets:", err)
+		return
+	}
+	if len(apiCfg.polkaSecrets) == 0 {
+		fmt.Println("POLKA_WEBHOOK_SECRETS not set, Polka webhooks will be rejected")
+	}
+	apiCfg.mailer = mailer.New()
+	apiCfg.publicURL = os.Getenv("PUBLIC_URL")
+	apiCfg.oidcProviders, err = oidc.LoadProviders(apiCfg.publicURL)
+	if err != nil {
+		fmt.Println("Failed to load login providers:", err)
+		return
+	}
+
+	// live events are sent through postgres so every server instance can stream them
+	apiCfg.broker = stream.NewBroker()
+	if err := stream.Listen(dbURL, apiCfg.broker, apiCfg.routeLiveEvent, "chirps", "notifications", "messages"); err != nil {
+		fmt.Println("Failed to listen for live events:", err)
+		return
+	}
+
+	// keep cached follow recommendations fresh
+	go apiCfg.recommendationsJob(10 * time.Minute)
+
+	// deactivated accounts are deleted for good once their grace period is over
+	go apiCfg.deleteDeactivatedUsersJob(time.Hour)
+
+	// data exports are built in the background
+	go apiCfg.dataExportJob(15 * time.Second)
+
+	// Chirpy Red ends once a subscription's period is over and Polka hasn't renewed it
+	go apiCfg.lapseSubscriptionsJob(5 * time.Minute)
 
 	// Serve static files from the /app/static directory under the /app/ path
 	fileServer := http.FileServer(http.Dir("./static")) // NOTE: if you are running this without docker, change this to ./
@@ -121,22 +294,40 @@ func main() {
 
 	// server status
 	mux.HandleFunc("GET /api/healthz", apiCfg.handlerHealthz)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerMetrics))
+
+	// GET /.well-known/jwks.json
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 
 	// dont allow this to happen unless the env variable is set to dev
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("POST /admin/reset", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerReset))
+
+	// POST /admin/users/{userID}/unlock
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerUnlockUser))
+
+	// PUT /admin/users/{userID}/role
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerSetUserRole))
+
+	// GET /admin/webhooks
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerGetWebhookEvents))
+
+	// POST /admin/webhooks/{source}/{eventID}/replay
+	mux.HandleFunc("POST /admin/webhooks/{source}/{eventID}/replay", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerReplayWebhookEvent))
 
 	// GET /api/chirps
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetAllChirps)
+	mux.HandleFunc("GET /api/chirps", apiCfg.publicScope(auth.ScopeChirpsRead, apiCfg.handlerGetAllChirps))
 
 	// GET /api/chirps/{chirpID}
-	mux.HandleFunc("GET /api/chirps/", apiCfg.handlerGetChirp)
+	mux.HandleFunc("GET /api/chirps/", apiCfg.publicScope(auth.ScopeChirpsRead, apiCfg.handlerGetChirp))
 
 	// DELETE /api/chirps/{chirpID}
-	mux.HandleFunc("DELETE /api/chirps/", apiCfg.deleteChirp)
+	mux.HandleFunc("DELETE /api/chirps/", apiCfg.requireScope(auth.ScopeChirpsWrite, apiCfg.deleteChirp))
+
+	// GET /api/stream/chirps
+	mux.HandleFunc("GET /api/stream/chirps", apiCfg.handlerStreamChirps)
 
 	// POst /api/chirps
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerPostChirp)
+	mux.HandleFunc("POST /api/chirps", apiCfg.requireScope(auth.ScopeChirpsWrite, apiCfg.handlerPostChirp))
 
 	// PUT /api/users
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
@@ -144,6 +335,72 @@ func main() {
 	// POST /api/users
 	mux.HandleFunc("POST /api/users", apiCfg.handlerPostUser)
 
+	// DELETE /api/users/me
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteUser)
+
+	// POST /api/users/me/delete-confirmation
+	mux.HandleFunc("POST /api/users/me/delete-confirmation", apiCfg.handlerSendDeleteConfirmation)
+
+	// POST /api/users/me/export
+	mux.HandleFunc("POST /api/users/me/export", apiCfg.handlerCreateDataExport)
+
+	// GET /api/users/me/export/{exportID}
+	mux.HandleFunc("GET /api/users/me/export/{exportID}", apiCfg.handlerGetDataExport)
+
+	// GET /api/users/me/recommendations
+	mux.HandleFunc("GET /api/users/me/recommendations", apiCfg.handlerGetRecommendations)
+
+	// GET /api/users/me/entitlements
+	mux.HandleFunc("GET /api/users/me/entitlements", apiCfg.handlerGetEntitlements)
+
+	// GET /api/users/me/subscription
+	mux.HandleFunc("GET /api/users/me/subscription", apiCfg.handlerGetSubscription)
+
+	// GET /api/users/me/preferences
+	mux.HandleFunc("GET /api/users/me/preferences", apiCfg.handlerGetPreferences)
+
+	// PUT /api/users/me/preferences
+	mux.HandleFunc("PUT /api/users/me/preferences", apiCfg.requireScope(auth.ScopeProfileWrite, apiCfg.handlerUpdatePreferences))
+
+	// PUT /api/users/me/handle
+	mux.HandleFunc("PUT /api/users/me/handle", apiCfg.requireScope(auth.ScopeProfileWrite, apiCfg.handlerUpdateHandle))
+
+	// POST /api/users/{userID}/follow
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollowUser)
+
+	// DELETE /api/users/{userID}/follow
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerUnfollowUser)
+
+	// GET /api/users/{userID}/followers
+	mux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.handlerGetFollowers)
+
+	// GET /api/users/{userID}/following
+	mux.HandleFunc("GET /api/users/{userID}/following", apiCfg.handlerGetFollowing)
+
+	// POST /api/users/{userID}/block
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.handlerBlockUser)
+
+	// DELETE /api/users/{userID}/block
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.handlerUnblockUser)
+
+	// GET /api/users/me/blocks
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.handlerGetBlockedUsers)
+
+	// POST /api/users/{userID}/mute
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.handlerMuteUser)
+
+	// DELETE /api/users/{userID}/mute
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.handlerUnmuteUser)
+
+	// GET /api/users/me/mutes
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.handlerGetMutedUsers)
+
+	// POST /api/users/verify
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+
+	// POST /api/users/verify/resend
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+
 	// POST /api/refresh
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken)
 
@@ -163,9 +420,118 @@ func main() {
 		w.WriteHeader(204)
 	})
 
+	// personal access tokens and OAuth tokens are only accepted by routes wrapped in requireScope
+	// GET /api/tokens
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerGetPersonalAccessTokens)
+
+	// POST /api/tokens
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerPostPersonalAccessToken)
+
+	// DELETE /api/tokens/{tokenID}
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.handlerDeletePersonalAccessToken)
+
+	// POST /api/oauth/clients
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerPostOAuthClient)
+
+	// GET /api/oauth/clients
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerGetOAuthClients)
+
+	// DELETE /api/oauth/clients/{clientID}
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.handlerDeleteOAuthClient)
+
+	// GET /api/oauth/grants
+	mux.HandleFunc("GET /api/oauth/grants", apiCfg.handlerGetOAuthGrants)
+
+	// DELETE /api/oauth/grants/{grantID}
+	mux.HandleFunc("DELETE /api/oauth/grants/{grantID}", apiCfg.handlerDeleteOAuthGrant)
+
+	// GET /oauth/authorize
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorize)
+
+	// POST /oauth/authorize
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.handlerOAuthApprove)
+
+	// POST /oauth/token
+	mux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+
+	// POST /oauth/revoke
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
+
+	// GET /api/sessions
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerGetSessions)
+
+	// DELETE /api/sessions/{sessionID}
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerDeleteSession)
+
+	// POST /api/sessions/revoke-all
+	mux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.handlerRevokeAllSessions)
+
+	// POST /api/password/forgot
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+
+	// POST /api/password/reset
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+
 	// POST /api/login
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
 
+	// POST /api/login/2fa
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLoginTwoFactor)
+
+	// POST /api/login/magic
+	mux.HandleFunc("POST /api/login/magic", apiCfg.handlerMagicLinkLogin)
+
+	// GET /api/login/magic/callback
+	mux.HandleFunc("GET /api/login/magic/callback", apiCfg.handlerMagicLinkPage)
+
+	// POST /api/login/magic/callback
+	mux.HandleFunc("POST /api/login/magic/callback", apiCfg.handlerMagicLinkCallback)
+
+	// GET /api/login/oidc/{provider}
+	mux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.handlerOIDCLogin)
+
+	// GET /api/login/oidc/{provider}/callback
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
+
+	// GET /api/2fa
+	mux.HandleFunc("GET /api/2fa", apiCfg.handlerGetTwoFactor)
+
+	// POST /api/2fa/enroll
+	mux.HandleFunc("POST /api/2fa/enroll", apiCfg.handlerEnrollTwoFactor)
+
+	// POST /api/2fa/confirm
+	mux.HandleFunc("POST /api/2fa/confirm", apiCfg.handlerConfirmTwoFactor)
+
+	// POST /api/2fa/disable
+	mux.HandleFunc("POST /api/2fa/disable", apiCfg.handlerDisableTwoFactor)
+
+	// GET /api/notifications
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+
+	// GET /api/notifications/unread_count
+	mux.HandleFunc("GET /api/notifications/unread_count", apiCfg.handlerUnreadNotificationCount)
+
+	// POST /api/notifications/read
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.handlerReadNotifications)
+
+	// GET /api/conversations
+	mux.HandleFunc("GET /api/conversations", apiCfg.handlerGetConversations)
+
+	// POST /api/conversations
+	mux.HandleFunc("POST /api/conversations", apiCfg.handlerPostConversation)
+
+	// GET /api/conversations/{conversationID}/messages
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.handlerGetMessages)
+
+	// POST /api/conversations/{conversationID}/messages
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.handlerPostMessage)
+
+	// POST /api/conversations/{conversationID}/read
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.handlerReadConversation)
+
+	// GET /api/ws
+	mux.HandleFunc("GET /api/ws", apiCfg.handlerWebSocket)
+
 	// POST /api/polka/webhooks
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerWebHooks)
 
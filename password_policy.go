@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/brayanMuniz/Chirpy/internal/auth"
+)
+
+// loadPasswordPolicy reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_SCORE (0 to 4), and
+// BREACHED_PASSWORDS_DIR for the local breached password list, which is optional
+func loadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength, err := envInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return nil, err
+	}
+	minScore, err := envInt("PASSWORD_MIN_SCORE", 2)
+	if err != nil {
+		return nil, err
+	}
+	if minScore > 4 {
+		return nil, errors.New("PASSWORD_MIN_SCORE must be between 1 and 4")
+	}
+
+	policy := &auth.PasswordPolicy{MinLength: minLength, MinScore: minScore}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		policy.Breached, err = auth.NewBreachedPasswords(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// checkNewPassword writes a 400 with every problem when the password breaks the policy, ok is false if it did
+func (c *apiConfig) checkNewPassword(w http.ResponseWriter, password, email string) (ok bool) {
+	problems, err := c.passwordPolicy.Check(password, email)
+	if err != nil {
+		fmt.Printf("Error checking password: %v\n", err)
+		writeJSONResponse(w, 500, map[string]string{"error": "Could not check your password"})
+		return false
+	}
+	if len(problems) == 0 {
+		return true
+	}
+
+	type policyErrorResponse struct {
+		Error    string                 `json:"error"`
+		Problems []auth.PasswordProblem `json:"problems"`
+	}
+	writeJSONResponse(w, 400, policyErrorResponse{
+		Error:    "Password does not meet the requirements",
+		Problems: problems,
+	})
+	return false
+}
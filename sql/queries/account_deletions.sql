@@ -0,0 +1,17 @@
+-- name: CreateAccountDeletionToken :one
+INSERT INTO account_deletion_tokens (token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, NOW(), NOW() + INTERVAL '1 hour', NULL
+)
+RETURNING *;
+
+-- name: CountRecentAccountDeletionTokens :one
+SELECT COUNT(*) FROM account_deletion_tokens
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour';
+
+-- name: ConsumeAccountDeletionToken :one
+-- only works once, before it expires, and for the user it was sent to
+UPDATE account_deletion_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
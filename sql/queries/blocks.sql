@@ -0,0 +1,42 @@
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: DeleteFollowsBetween :exec
+-- blocking someone ends the follows in both directions
+DELETE FROM follows
+WHERE (follower_id = $1 AND followee_id = $2) OR (follower_id = $2 AND followee_id = $1);
+
+-- name: GetBlockedUsers :many
+SELECT blocked_id, created_at FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: IsBlockedEitherWay :one
+SELECT EXISTS (
+	SELECT 1 FROM user_blocks
+	WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+);
+
+-- name: GetMessagingRestriction :one
+-- why the sender can't message the recipient: blocked, followers_only, or empty when they can
+SELECT CASE
+	WHEN EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = sqlc.arg(sender_id) AND blocked_id = users.id)
+			OR (blocker_id = users.id AND blocked_id = sqlc.arg(sender_id))
+	) THEN 'blocked'
+	WHEN users.dms_from = 'followers' AND NOT EXISTS (
+		SELECT 1 FROM follows
+		WHERE follower_id = sqlc.arg(sender_id) AND followee_id = users.id
+	) THEN 'followers_only'
+	ELSE ''
+END::TEXT AS restriction
+FROM users
+WHERE users.id = sqlc.arg(recipient_id);
@@ -6,9 +6,11 @@ VALUES (
 RETURNING *;
 
 -- name: GetChirps :many
+-- chirps of deactivated users are hidden in every query, until they log in again
 SELECT * 
 FROM chirps
 WHERE ($1 = '00000000-0000-0000-0000-000000000000'::UUID OR user_id = $1)
+	AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
 ORDER BY 
     CASE 
         WHEN $2 = 'desc' THEN created_at 
@@ -21,7 +23,7 @@ ORDER BY
 
 -- name: GetChirp :one
 SELECT * FROM chirps 
-WHERE id = $1;
+WHERE id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL);
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
@@ -29,3 +31,13 @@ WHERE id = $1;
 
 -- name: DeleteAllChirps :exec
 DELETE FROM chirps;
+
+-- name: GetChirpsAfter :many
+SELECT * FROM chirps
+WHERE created_at > (SELECT c.created_at FROM chirps c WHERE c.id = $1)
+	AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+ORDER BY created_at ASC
+LIMIT 100;
+
+-- name: NotifyChirp :exec
+SELECT pg_notify('chirps', $1);
@@ -0,0 +1,50 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at)
+VALUES (
+	$1, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at, last_read_at)
+VALUES (
+	$1, $2, NOW(), NULL
+);
+
+-- name: GetDirectConversation :one
+-- the one-to-one conversation between two users, if they already have one
+SELECT c.* FROM conversations c
+JOIN conversation_members a ON a.conversation_id = c.id AND a.user_id = $1
+JOIN conversation_members b ON b.conversation_id = c.id AND b.user_id = $2
+WHERE (SELECT COUNT(*) FROM conversation_members m WHERE m.conversation_id = c.id) = 2
+LIMIT 1;
+
+-- name: GetConversationsForUser :many
+SELECT c.id, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM messages m
+	 WHERE m.conversation_id = c.id AND m.sender_id != cm.user_id
+	 AND (cm.last_read_at IS NULL OR m.created_at > cm.last_read_at)) AS unread_count
+FROM conversations c
+JOIN conversation_members cm ON cm.conversation_id = c.id
+WHERE cm.user_id = $1
+ORDER BY c.updated_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetConversationMembers :many
+SELECT * FROM conversation_members
+WHERE conversation_id = $1
+ORDER BY joined_at ASC;
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members
+SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,45 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (
+	$1, $2, 'pending', NOW()
+)
+RETURNING id, user_id, status, created_at, completed_at, expires_at;
+
+-- name: CountRecentDataExports :one
+SELECT COUNT(*) FROM data_exports
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 day';
+
+-- name: ClaimDataExport :one
+-- the oldest export nobody is building, SKIP LOCKED lets every server instance run the job
+UPDATE data_exports
+SET started_at = NOW()
+WHERE id = (
+	SELECT e.id FROM data_exports e
+	WHERE e.status = 'pending' AND (e.started_at IS NULL OR e.started_at < NOW() - INTERVAL '10 minutes')
+	ORDER BY e.created_at ASC
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = NOW(), expires_at = NOW() + INTERVAL '7 days'
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1;
+
+-- name: GetDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1 AND user_id = $2 AND status = 'ready' AND expires_at > NOW();
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at < NOW() OR (status = 'failed' AND created_at < NOW() - INTERVAL '7 days');
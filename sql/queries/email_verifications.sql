@@ -0,0 +1,17 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, $3, NOW(), NOW() + INTERVAL '24 hours', NULL
+)
+RETURNING *;
+
+-- name: CountRecentEmailVerificationTokens :one
+SELECT COUNT(*) FROM email_verification_tokens
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour';
+
+-- name: ConsumeEmailVerificationToken :one
+-- only works once, and only before it expires
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,29 @@
+-- name: FollowUser :execrows
+-- 0 rows when they already follow them
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowing :many
+SELECT follows.followee_id, follows.created_at FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = $1 AND users.deactivated_at IS NULL
+ORDER BY follows.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetFollowers :many
+SELECT follows.follower_id, follows.created_at FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1 AND users.deactivated_at IS NULL
+ORDER BY follows.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetTimelineFollowers :many
+-- who gets the user's new chirps on their live home timeline, followers who muted them are left out
+SELECT follower_id FROM follows
+WHERE followee_id = $1
+	AND follower_id NOT IN (SELECT muter_id FROM user_mutes WHERE muted_id = $1);
@@ -0,0 +1,25 @@
+-- name: GetLoginLockout :one
+-- seconds until every one of the keys can log in again, 0 if none are locked
+SELECT COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(locked_until) - NOW())), 0)::int AS retry_after
+FROM login_throttles
+WHERE key = ANY($1::text[]) AND locked_until > NOW();
+
+-- name: RecordLoginFailure :one
+-- failures are forgotten after an hour without any
+INSERT INTO login_throttles (key, failures, last_failure_at, locked_until)
+VALUES (
+	$1, 1, NOW(), NULL
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE WHEN login_throttles.last_failure_at < NOW() - INTERVAL '1 hour' THEN 1 ELSE login_throttles.failures + 1 END,
+	last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = NOW() + make_interval(secs => $2)
+WHERE key = $1;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
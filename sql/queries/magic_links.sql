@@ -0,0 +1,17 @@
+-- name: CreateMagicLinkToken :one
+INSERT INTO magic_link_tokens (token_hash, user_id, device_name, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, $3, NOW(), NOW() + INTERVAL '15 minutes', NULL
+)
+RETURNING *;
+
+-- name: CountRecentMagicLinkTokens :one
+SELECT COUNT(*) FROM magic_link_tokens
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour';
+
+-- name: ConsumeMagicLinkToken :one
+-- only works once, and only before it expires
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,27 @@
+-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, created_at, updated_at, body)
+VALUES (
+	$1, $2, $3, NOW(), NOW(), $4
+)
+RETURNING *;
+
+-- name: GetMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: NotifyMessage :exec
+SELECT pg_notify('messages', $1);
+
+-- name: GetMessagesBySender :many
+SELECT * FROM messages
+WHERE sender_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetMessagesForRecipient :many
+-- what the others in the user's conversations sent
+SELECT messages.* FROM messages
+JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+WHERE conversation_members.user_id = $1 AND messages.sender_id != $1
+ORDER BY messages.created_at ASC;
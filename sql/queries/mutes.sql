@@ -0,0 +1,20 @@
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :execrows
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutedUsers :many
+SELECT muted_id, created_at FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: IsMuted :one
+SELECT EXISTS (
+	SELECT 1 FROM user_mutes
+	WHERE muter_id = $1 AND muted_id = $2
+);
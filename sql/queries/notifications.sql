@@ -0,0 +1,43 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, updated_at, user_id, actor_id, type, chirp_id, read_at)
+VALUES (
+	$1, NOW(), NOW(), $2, $3, $4, $5, NULL
+)
+RETURNING *;
+
+-- name: GetGroupedNotifications :many
+-- similar notifications (same type and chirp) are collapsed into one row so
+-- the client can render "5 people followed you"
+SELECT type, chirp_id,
+	COUNT(DISTINCT actor_id) AS actor_count,
+	(ARRAY_AGG(actor_id ORDER BY created_at DESC))[1]::UUID AS latest_actor_id,
+	MAX(created_at)::TIMESTAMP AS latest_at,
+	BOOL_OR(read_at IS NULL) AS unread,
+	ARRAY_AGG(id)::UUID[] AS ids
+FROM notifications
+WHERE user_id = $1 AND ($2::TEXT = '' OR type = $2)
+GROUP BY type, chirp_id
+ORDER BY latest_at DESC
+LIMIT $3 OFFSET $4;
+
+-- name: GetNotificationsForUser :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications
+SET updated_at = NOW(), read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL AND id = ANY($2::UUID[]);
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET updated_at = NOW(), read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: NotifyNotification :exec
+SELECT pg_notify('notifications', $1);
@@ -0,0 +1,93 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, created_at)
+VALUES (
+	$1, $2, $3, $4, $5, NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClientsForUser :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, grant_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, $3, $4, $5, $6, $7, NOW(), NOW() + INTERVAL '10 minutes', NULL
+);
+
+-- name: GetOAuthAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1;
+
+-- name: ConsumeOAuthAuthorizationCode :one
+-- only works once, and only before it expires
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, client_id, user_id, scopes, created_at, revoked_at)
+VALUES (
+	$1, $2, $3, $4, NOW(), NULL
+)
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+-- only grants that have not been revoked
+SELECT * FROM oauth_grants
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: GetOAuthGrantsForUser :many
+-- the apps a user has connected
+SELECT oauth_grants.id, oauth_grants.client_id, oauth_clients.name AS client_name, oauth_grants.scopes, oauth_grants.created_at
+FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE oauth_grants.user_id = $1 AND oauth_grants.revoked_at IS NULL
+ORDER BY oauth_grants.created_at DESC;
+
+-- name: IsOAuthGrantActive :one
+SELECT EXISTS (
+	SELECT 1 FROM oauth_grants
+	WHERE id = $1 AND revoked_at IS NULL
+);
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthGrantForUser :execrows
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthGrants :exec
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (token_hash, grant_id, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, NOW(), NOW() + INTERVAL '60 days', NULL
+);
+
+-- name: GetOAuthRefreshToken :one
+SELECT * FROM oauth_refresh_tokens
+WHERE token_hash = $1;
+
+-- name: UseOAuthRefreshToken :execrows
+-- zero rows means another request rotated it first
+UPDATE oauth_refresh_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
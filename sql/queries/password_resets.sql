@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, NOW(), NOW() + INTERVAL '1 hour', NULL
+)
+RETURNING *;
+
+-- name: CountRecentPasswordResetTokens :one
+SELECT COUNT(*) FROM password_reset_tokens
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour';
+
+-- name: ConsumePasswordResetToken :one
+-- only works once, and only before it expires
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,94 @@
+-- name: ComputeRecommendations :many
+-- friends of friends (followed by people the user follows), people who use the same hashtags,
+-- and people who gained followers this week. Anyone the user follows, blocked (either way) or muted is left out
+WITH following AS (
+	SELECT followee_id AS user_id FROM follows
+	WHERE follower_id = $1
+),
+friends_of_friends AS (
+	SELECT f.followee_id AS user_id, COUNT(*) AS followed_by_friends
+	FROM follows f
+	WHERE f.follower_id IN (SELECT user_id FROM following)
+	GROUP BY f.followee_id
+),
+my_hashtags AS (
+	SELECT DISTINCT LOWER(m[1]) AS hashtag
+	FROM chirps, REGEXP_MATCHES(chirps.body, '#(\w+)', 'g') AS m
+	WHERE chirps.user_id = $1
+),
+shared AS (
+	SELECT c.user_id, COUNT(DISTINCT LOWER(m[1])) AS shared_hashtags
+	FROM chirps c, REGEXP_MATCHES(c.body, '#(\w+)', 'g') AS m
+	WHERE c.user_id != $1 AND LOWER(m[1]) IN (SELECT hashtag FROM my_hashtags)
+	GROUP BY c.user_id
+),
+popular AS (
+	SELECT f.followee_id AS user_id, COUNT(*) AS new_followers
+	FROM follows f
+	WHERE f.created_at > NOW() - INTERVAL '7 days'
+	GROUP BY f.followee_id
+)
+SELECT u.id AS recommended_user_id,
+	COALESCE(ff.followed_by_friends, 0)::BIGINT AS followed_by_friends,
+	COALESCE(s.shared_hashtags, 0)::BIGINT AS shared_hashtags,
+	COALESCE(p.new_followers, 0)::BIGINT AS new_followers,
+	(COALESCE(ff.followed_by_friends, 0) * 5 + COALESCE(s.shared_hashtags, 0) * 3 + COALESCE(p.new_followers, 0))::BIGINT AS score
+FROM users u
+LEFT JOIN friends_of_friends ff ON ff.user_id = u.id
+LEFT JOIN shared s ON s.user_id = u.id
+LEFT JOIN popular p ON p.user_id = u.id
+WHERE u.id != $1 AND u.deactivated_at IS NULL
+	AND (ff.user_id IS NOT NULL OR s.user_id IS NOT NULL OR p.user_id IS NOT NULL)
+	AND u.id NOT IN (SELECT user_id FROM following)
+	AND u.id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $1)
+	AND u.id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = $1)
+	AND u.id NOT IN (SELECT muted_id FROM user_mutes WHERE muter_id = $1)
+ORDER BY score DESC
+LIMIT $2;
+
+-- name: CreateRecommendation :exec
+INSERT INTO user_recommendations (user_id, recommended_user_id, followed_by_friends, shared_hashtags, new_followers, score)
+VALUES (
+	$1, $2, $3, $4, $5, $6
+);
+
+-- name: DeleteRecommendations :exec
+DELETE FROM user_recommendations
+WHERE user_id = $1;
+
+-- name: GetRecommendations :many
+-- follows, blocks and mutes since the cache was computed are left out too
+SELECT r.* FROM user_recommendations r
+WHERE r.user_id = $1
+	AND NOT EXISTS (SELECT 1 FROM follows WHERE follower_id = r.user_id AND followee_id = r.recommended_user_id)
+	AND NOT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = r.user_id AND blocked_id = r.recommended_user_id)
+			OR (blocker_id = r.recommended_user_id AND blocked_id = r.user_id)
+	)
+	AND NOT EXISTS (SELECT 1 FROM user_mutes WHERE muter_id = r.user_id AND muted_id = r.recommended_user_id)
+ORDER BY r.score DESC
+LIMIT $2;
+
+-- name: GetRecommendationCache :one
+SELECT * FROM recommendation_cache
+WHERE user_id = $1;
+
+-- name: UpsertRecommendationCache :exec
+INSERT INTO recommendation_cache (user_id, computed_at, requested_at)
+VALUES (
+	$1, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE SET computed_at = NOW();
+
+-- name: TouchRecommendationCache :exec
+UPDATE recommendation_cache
+SET requested_at = NOW()
+WHERE user_id = $1;
+
+-- name: GetStaleRecommendationCaches :many
+-- only for users who asked for recommendations this week, everyone else's are computed again when they ask
+SELECT user_id FROM recommendation_cache
+WHERE computed_at < NOW() - INTERVAL '1 hour' AND requested_at > NOW() - INTERVAL '7 days'
+ORDER BY computed_at ASC
+LIMIT 100;
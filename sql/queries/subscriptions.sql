@@ -0,0 +1,46 @@
+-- name: StartSubscription :one
+-- current_period_end is 30 days from now when Polka doesn't send one
+INSERT INTO subscriptions (user_id, plan, status, current_period_end, canceled_at, created_at, updated_at)
+VALUES (
+	$1, $2, 'active', COALESCE(sqlc.narg('current_period_end'), NOW() + INTERVAL '30 days'), NULL, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE SET plan = EXCLUDED.plan, status = 'active',
+	current_period_end = EXCLUDED.current_period_end, canceled_at = NULL, updated_at = NOW()
+RETURNING *;
+
+-- name: RenewSubscription :one
+-- without a current_period_end from Polka, 30 days are added to what was left
+UPDATE subscriptions
+SET status = 'active', canceled_at = NULL, updated_at = NOW(),
+	current_period_end = COALESCE(sqlc.narg('current_period_end'), GREATEST(current_period_end, NOW()) + INTERVAL '30 days')
+WHERE user_id = $1
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :execrows
+-- Red is kept until the period ends, Polka keeps trying to charge until then
+UPDATE subscriptions
+SET status = 'past_due', updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: CancelSubscription :execrows
+-- Red is kept until the end of the period that was paid for
+UPDATE subscriptions
+SET status = 'canceled', canceled_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: LapseExpiredSubscriptions :many
+-- ends every subscription past its period, and takes Red away from those users
+WITH lapsed AS (
+	UPDATE subscriptions
+	SET status = 'lapsed', updated_at = NOW()
+	WHERE status != 'lapsed' AND current_period_end < NOW()
+	RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+WHERE id IN (SELECT user_id FROM lapsed)
+RETURNING id;
@@ -1,7 +1,7 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, device_name, user_agent, ip, last_used_at)
 VALUES (
-	$1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
+	$1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3, $4, $5, $6, NOW()
 )
 RETURNING *;
 
@@ -11,9 +11,51 @@ SET updated_at = NOW(), revoked_at = NOW()
 WHERE token = $1
 RETURNING *;
 
+-- name: RotateRefreshToken :one
+-- only succeeds once per token, a second rotation means the token was stolen
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE token = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: GetActiveSessions :many
+-- one row per session, the live token of each family
+SELECT family_id, device_name, user_agent, ip, last_used_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::TIMESTAMP AS signed_in_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+	SELECT 1 FROM refresh_tokens
+	WHERE family_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+);
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllSessions :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
 WHERE token = $1;
 
 -- name: DeleteAllRefreshTokens :exec
 DELETE FROM refresh_tokens;
+
+-- name: TouchSession :exec
+-- at most once a minute, so a busy session doesn't write on every request
+UPDATE refresh_tokens
+SET last_used_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL AND last_used_at < NOW() - INTERVAL '1 minute';
@@ -0,0 +1,67 @@
+-- name: CreateTOTPSecret :one
+-- starts (or restarts) enrollment, an enabled secret is never replaced
+INSERT INTO user_totp (user_id, secret, created_at, enabled_at, last_used_step)
+VALUES (
+	$1, $2, NOW(), NULL, 0
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: EnableTOTP :exec
+UPDATE user_totp
+SET enabled_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+
+-- name: UseTOTPStep :execrows
+-- zero rows means the code was already used
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, user_id, created_at, used_at)
+VALUES (
+	$1, $2, NOW(), NULL
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND user_id = $2 AND used_at IS NULL;
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (token_hash, user_id, device_name, created_at, expires_at, attempts, used_at)
+VALUES (
+	$1, $2, $3, NOW(), NOW() + INTERVAL '5 minutes', 0, NULL
+)
+RETURNING *;
+
+-- name: AttemptLoginChallenge :one
+-- counts every try so the 6 digit code cant be brute forced with one challenge
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < 5
+RETURNING *;
+
+-- name: ConsumeLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
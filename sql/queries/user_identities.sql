@@ -0,0 +1,33 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, device_name, created_at, expires_at, used_at)
+VALUES (
+	$1, $2, $3, $4, $5, NOW(), NOW() + INTERVAL '10 minutes', NULL
+);
+
+-- name: ConsumeOIDCLoginState :one
+-- only works once, only before it expires, and only for the provider it was made for
+UPDATE oidc_login_states
+SET used_at = NOW()
+WHERE state_hash = $1 AND provider = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (provider, subject, user_id, email, created_at, last_login_at)
+VALUES (
+	$1, $2, $3, $4, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW()
+WHERE provider = $1 AND subject = $2;
+
+-- name: GetUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
@@ -22,3 +22,69 @@ WHERE email = $1;
 
 -- name: DeleteAll :exec
 DELETE FROM users;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetPendingEmail :exec
+UPDATE users
+SET pending_email = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyEmail :one
+-- also used for email changes, the confirmed address becomes the account's email
+UPDATE users
+SET email = $2, email_verified_at = NOW(), updated_at = NOW(),
+	pending_email = CASE WHEN pending_email = $2 THEN NULL ELSE pending_email END
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeactivateUser :one
+UPDATE users
+SET deactivated_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deactivated_at IS NULL
+RETURNING *;
+
+-- name: ReactivateUser :exec
+UPDATE users
+SET deactivated_at = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteDeactivatedUsers :execrows
+-- chirps, refresh tokens and everything else of theirs goes with them (ON DELETE CASCADE)
+DELETE FROM users
+WHERE deactivated_at < NOW() - INTERVAL '30 days';
+
+-- name: SetDmsFrom :one
+UPDATE users
+SET dms_from = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetHandle :one
+UPDATE users
+SET handle = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetMentionedUsers :many
+-- the active users with these handles, leaving out anyone the author blocked or was blocked by
+SELECT id FROM users
+WHERE handle = ANY(sqlc.arg(handles)::TEXT[]) AND deactivated_at IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = sqlc.arg(author_id) AND blocked_id = users.id)
+			OR (blocker_id = users.id AND blocked_id = sqlc.arg(author_id))
+	);
@@ -0,0 +1,29 @@
+-- name: CreateWebhookEvent :execrows
+-- no rows when the event has been received before
+INSERT INTO webhook_events (id, source, event, received_at, payload, status)
+VALUES (
+	$1, $2, $3, NOW(), $4, 'received'
+)
+ON CONFLICT (source, id) DO NOTHING;
+
+-- name: LockWebhookEvent :one
+-- only one delivery (or replay) of an event is processed at a time
+SELECT * FROM webhook_events
+WHERE source = $1 AND id = $2
+FOR UPDATE;
+
+-- name: FinishWebhookEvent :exec
+UPDATE webhook_events
+SET status = $3, error = NULL, attempts = attempts + 1, processed_at = NOW()
+WHERE source = $1 AND id = $2;
+
+-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'failed', error = $3, attempts = attempts + 1
+WHERE source = $1 AND id = $2;
+
+-- name: GetWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE ($1::TEXT = '' OR status = $1)
+ORDER BY received_at DESC
+LIMIT $2 OFFSET $3;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE notifications (
+	id UUID, 
+	created_at TIMESTAMP NOT NULL, 
+	updated_at TIMESTAMP NOT NULL, 
+	user_id UUID NOT NULL, -- who receives the notification
+	actor_id UUID NOT NULL, -- who caused it
+	type TEXT NOT NULL, -- follow, mention, reply, like, rechirp
+	chirp_id UUID, -- NULL for follows
+	read_at TIMESTAMP, 
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications(user_id, created_at);
+
+-- +goose Down
+DROP TABLE notifications;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE conversations (
+	id UUID, 
+	created_at TIMESTAMP NOT NULL, 
+	updated_at TIMESTAMP NOT NULL, -- bumped on every new message
+
+	PRIMARY KEY(id)
+);
+
+CREATE TABLE conversation_members (
+	conversation_id UUID NOT NULL, 
+	user_id UUID NOT NULL, 
+	joined_at TIMESTAMP NOT NULL, 
+	last_read_at TIMESTAMP, -- read receipts
+
+	PRIMARY KEY(conversation_id, user_id),
+	FOREIGN KEY(conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE messages (
+	id UUID, 
+	conversation_id UUID NOT NULL, 
+	sender_id UUID NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	updated_at TIMESTAMP NOT NULL, 
+	body VARCHAR(1000) NOT NULL, 
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+	FOREIGN KEY(sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_idx ON messages(conversation_id, created_at);
+
+-- +goose Down
+DROP TABLE messages;
+DROP TABLE conversation_members;
+DROP TABLE conversations;
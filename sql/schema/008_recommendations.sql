@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE user_recommendations (
+	user_id UUID NOT NULL, -- who the recommendation is for
+	recommended_user_id UUID NOT NULL, 
+	shared_hashtags BIGINT NOT NULL, 
+	recent_chirps BIGINT NOT NULL, -- chirps in the last week
+	score BIGINT NOT NULL, 
+
+	PRIMARY KEY(user_id, recommended_user_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(recommended_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- when each user's recommendations were last computed, even if there were none
+CREATE TABLE recommendation_cache (
+	user_id UUID, 
+	computed_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(user_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE recommendation_cache;
+DROP TABLE user_recommendations;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- every login starts a family, every refresh rotates to a new token in the same family
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD COLUMN replaced_by VARCHAR(64); -- the token this one was rotated to
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN replaced_by,
+DROP COLUMN family_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- a session is a refresh token family, each rotation carries these over to the new token
+ALTER TABLE refresh_tokens
+ADD COLUMN device_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens(user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip,
+DROP COLUMN user_agent,
+DROP COLUMN device_name;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens (
+	token_hash VARCHAR(64), -- sha256 of the token that was emailed, the token itself is never stored
+	user_id UUID NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens(user_id, created_at);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
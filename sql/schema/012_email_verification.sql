@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP,
+ADD COLUMN pending_email TEXT; -- the new address until it is confirmed
+
+-- accounts from before verification existed keep working
+UPDATE users SET email_verified_at = NOW();
+
+CREATE TABLE email_verification_tokens (
+	token_hash VARCHAR(64), -- sha256 of the token that was emailed
+	user_id UUID NOT NULL, 
+	email TEXT NOT NULL, -- the address being verified
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens(user_id, created_at);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN pending_email,
+DROP COLUMN email_verified_at;
@@ -0,0 +1,42 @@
+-- +goose Up
+CREATE TABLE user_totp (
+	user_id UUID, 
+	secret TEXT NOT NULL, -- base32, needed in plain text to compute the codes
+	created_at TIMESTAMP NOT NULL, 
+	enabled_at TIMESTAMP, -- NULL until the first code is confirmed
+	last_used_step BIGINT NOT NULL DEFAULT 0, -- so the same code cant be used twice
+
+	PRIMARY KEY(user_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+	code_hash VARCHAR(64), -- sha256 of the code
+	user_id UUID NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(code_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes(user_id);
+
+-- the first step of a login for users with 2FA, traded for tokens along with a code
+CREATE TABLE login_challenges (
+	token_hash VARCHAR(64), -- sha256 of the challenge token
+	user_id UUID NOT NULL, 
+	device_name TEXT NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	attempts INTEGER NOT NULL DEFAULT 0, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
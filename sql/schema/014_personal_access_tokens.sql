@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE personal_access_tokens (
+	id UUID, 
+	user_id UUID NOT NULL, 
+	name TEXT NOT NULL, 
+	token_hash VARCHAR(64) NOT NULL UNIQUE, -- sha256 of the token, it is only shown when it is made
+	scopes TEXT[] NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	last_used_at TIMESTAMP, 
+	revoked_at TIMESTAMP, 
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens(user_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
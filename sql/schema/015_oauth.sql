@@ -0,0 +1,63 @@
+-- +goose Up
+-- third party apps, registered by a user
+CREATE TABLE oauth_clients (
+	id UUID, -- the client_id
+	user_id UUID NOT NULL, -- who registered it
+	name TEXT NOT NULL, 
+	secret_hash VARCHAR(64), -- sha256 of the client_secret, NULL for public clients (mobile and browser apps)
+	redirect_uris TEXT[] NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- a user letting a client act for them, every token the client gets comes from one
+CREATE TABLE oauth_grants (
+	id UUID, 
+	client_id UUID NOT NULL, 
+	user_id UUID NOT NULL, 
+	scopes TEXT[] NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	revoked_at TIMESTAMP, 
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX oauth_grants_user_id_idx ON oauth_grants(user_id);
+
+CREATE TABLE oauth_authorization_codes (
+	code_hash VARCHAR(64), -- sha256 of the code
+	client_id UUID NOT NULL, 
+	user_id UUID NOT NULL, 
+	grant_id UUID NOT NULL, -- the grant made when the code is exchanged, so it can be revoked if the code is used twice
+	redirect_uri TEXT NOT NULL, 
+	scopes TEXT[] NOT NULL, 
+	code_challenge TEXT NOT NULL, -- PKCE S256
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(code_hash),
+	FOREIGN KEY(client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE oauth_refresh_tokens (
+	token_hash VARCHAR(64), -- sha256 of the token
+	grant_id UUID NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, -- set when it is rotated, using it again revokes the grant
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(grant_id) REFERENCES oauth_grants(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE oauth_refresh_tokens;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_grants;
+DROP TABLE oauth_clients;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- accounts at external OpenID Connect providers that can log in as a user
+CREATE TABLE user_identities (
+	provider TEXT, -- the name it is configured under in OIDC_PROVIDERS
+	subject TEXT, -- the sub claim, the provider's id for the account
+	user_id UUID NOT NULL, 
+	email TEXT NOT NULL, -- what the provider said the email was when it was linked
+	created_at TIMESTAMP NOT NULL, 
+	last_login_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(provider, subject),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities(user_id);
+
+-- a login that went to a provider and has not come back yet
+CREATE TABLE oidc_login_states (
+	state_hash VARCHAR(64), -- sha256 of the state param
+	provider TEXT NOT NULL, 
+	nonce TEXT NOT NULL, 
+	code_verifier TEXT NOT NULL, -- PKCE
+	device_name TEXT NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(state_hash)
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
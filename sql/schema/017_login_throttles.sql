@@ -0,0 +1,13 @@
+-- +goose Up
+-- failed logins per account (by email, even ones without an account) and per IP
+CREATE TABLE login_throttles (
+	key TEXT, -- "account:<email>" or "ip:<address>"
+	failures INTEGER NOT NULL, 
+	last_failure_at TIMESTAMP NOT NULL, 
+	locked_until TIMESTAMP, 
+
+	PRIMARY KEY(key)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
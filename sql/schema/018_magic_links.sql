@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+	token_hash VARCHAR(64), -- sha256 of the token in the emailed link, the token itself is never stored
+	user_id UUID NOT NULL, 
+	device_name TEXT NOT NULL DEFAULT '', -- for the session the link starts
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens(user_id, created_at);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- deactivated users are deleted for good 30 days later, unless they log in again before that
+ALTER TABLE users
+ADD COLUMN deactivated_at TIMESTAMP;
+
+CREATE INDEX users_deactivated_at_idx ON users(deactivated_at) WHERE deactivated_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_deactivated_at_idx;
+
+ALTER TABLE users
+DROP COLUMN deactivated_at;
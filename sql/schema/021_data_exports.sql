@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE data_exports (
+	id UUID, 
+	user_id UUID NOT NULL, 
+	status TEXT NOT NULL, -- pending, ready or failed
+	created_at TIMESTAMP NOT NULL, 
+	started_at TIMESTAMP, -- when a server started building it, another one takes over if it takes too long
+	completed_at TIMESTAMP, 
+	expires_at TIMESTAMP, -- set once it is ready, it can't be downloaded after this
+	archive BYTEA, -- the zip, NULL until it is ready
+
+	PRIMARY KEY(id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports(user_id, created_at);
+CREATE INDEX data_exports_pending_idx ON data_exports(created_at) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE data_exports;
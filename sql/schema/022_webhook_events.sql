@@ -0,0 +1,13 @@
+-- +goose Up
+-- every webhook event that was applied, so a replayed delivery is not applied twice
+CREATE TABLE webhook_events (
+	id TEXT, -- the sender's event id
+	source TEXT NOT NULL, -- who sent it, like polka
+	event TEXT NOT NULL, 
+	received_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(source, id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
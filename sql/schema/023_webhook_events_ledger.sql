@@ -0,0 +1,20 @@
+-- +goose Up
+-- keep what was sent and what happened with it, so failed events can be looked at and replayed
+ALTER TABLE webhook_events
+ADD COLUMN payload TEXT NOT NULL DEFAULT '', -- the raw body, exactly as it was signed
+ADD COLUMN status TEXT NOT NULL DEFAULT 'processed', -- received, processed, ignored or failed
+ADD COLUMN error TEXT, -- why the last attempt failed
+ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN processed_at TIMESTAMP;
+
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, received_at);
+
+-- +goose Down
+DROP INDEX webhook_events_status_idx;
+
+ALTER TABLE webhook_events
+DROP COLUMN payload,
+DROP COLUMN status,
+DROP COLUMN error,
+DROP COLUMN attempts,
+DROP COLUMN processed_at;
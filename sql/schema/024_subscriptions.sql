@@ -0,0 +1,25 @@
+-- +goose Up
+-- Chirpy Red subscriptions, kept up to date by Polka's webhooks. users.is_chirpy_red follows the status
+CREATE TABLE subscriptions (
+	user_id UUID, 
+	plan TEXT NOT NULL, 
+	status TEXT NOT NULL, -- active, past_due (a payment failed), canceled (ends with the period) or lapsed
+	current_period_end TIMESTAMP NOT NULL, -- Red lasts until this, unless it is renewed
+	canceled_at TIMESTAMP, 
+	created_at TIMESTAMP NOT NULL, 
+	updated_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(user_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions(current_period_end) WHERE status != 'lapsed';
+
+-- users who upgraded before subscriptions get a period, Polka renews it like any other
+INSERT INTO subscriptions (user_id, plan, status, current_period_end, canceled_at, created_at, updated_at)
+SELECT id, 'red', 'active', NOW() + INTERVAL '30 days', NULL, NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Chirpy Red allows longer chirps, the limit for each plan is checked by the server (see entitlements.go)
+ALTER TABLE chirps
+ALTER COLUMN body TYPE VARCHAR(500);
+
+-- +goose Down
+-- NOTE: chirps longer than 140 are cut off
+ALTER TABLE chirps
+ALTER COLUMN body TYPE VARCHAR(140) USING LEFT(body, 140);
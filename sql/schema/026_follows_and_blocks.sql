@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE follows (
+	follower_id UUID, 
+	followee_id UUID, 
+	created_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(follower_id, followee_id),
+	FOREIGN KEY(follower_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(followee_id) REFERENCES users(id) ON DELETE CASCADE,
+	CHECK (follower_id != followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows(followee_id);
+
+-- blocks go both ways, neither user can message or follow the other
+CREATE TABLE user_blocks (
+	blocker_id UUID, 
+	blocked_id UUID, 
+	created_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(blocker_id, blocked_id),
+	FOREIGN KEY(blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(blocked_id) REFERENCES users(id) ON DELETE CASCADE,
+	CHECK (blocker_id != blocked_id)
+);
+
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks(blocked_id);
+
+-- who can start conversations with and message the user: everyone, or only people following them
+ALTER TABLE users
+ADD COLUMN dms_from TEXT NOT NULL DEFAULT 'everyone' CHECK (dms_from IN ('everyone', 'followers'));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN dms_from;
+
+DROP TABLE user_blocks;
+DROP TABLE follows;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- muted users are left out of the muter's recommendations and can't notify them, they don't know about it
+CREATE TABLE user_mutes (
+	muter_id UUID, 
+	muted_id UUID, 
+	created_at TIMESTAMP NOT NULL, 
+
+	PRIMARY KEY(muter_id, muted_id),
+	FOREIGN KEY(muter_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(muted_id) REFERENCES users(id) ON DELETE CASCADE,
+	CHECK (muter_id != muted_id)
+);
+
+-- recommendations come from the follow graph now, the cached ones were made without it
+DELETE FROM user_recommendations;
+DELETE FROM recommendation_cache;
+
+ALTER TABLE user_recommendations
+RENAME COLUMN recent_chirps TO new_followers; -- followers gained in the last week
+
+ALTER TABLE user_recommendations
+ADD COLUMN followed_by_friends BIGINT NOT NULL DEFAULT 0; -- how many people the user follows follow them
+
+-- only users who asked for recommendations lately get them refreshed
+ALTER TABLE recommendation_cache
+ADD COLUMN requested_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- +goose Down
+ALTER TABLE recommendation_cache
+DROP COLUMN requested_at;
+
+ALTER TABLE user_recommendations
+DROP COLUMN followed_by_friends;
+
+ALTER TABLE user_recommendations
+RENAME COLUMN new_followers TO recent_chirps;
+
+DROP TABLE user_mutes;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- lets users without a password (logged in through a provider) confirm deleting their account by email
+CREATE TABLE account_deletion_tokens (
+	token_hash VARCHAR(64), -- sha256 of the emailed token, the token itself is never stored
+	user_id UUID NOT NULL, 
+	created_at TIMESTAMP NOT NULL, 
+	expires_at TIMESTAMP NOT NULL, 
+	used_at TIMESTAMP, 
+
+	PRIMARY KEY(token_hash),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX account_deletion_tokens_user_id_idx ON account_deletion_tokens(user_id, created_at);
+
+-- +goose Down
+DROP TABLE account_deletion_tokens;
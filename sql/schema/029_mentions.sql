@@ -0,0 +1,15 @@
+-- +goose Up
+-- what people write after an @ in a chirp to mention the user, lowercase
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE;
+
+-- replies, likes and rechirps don't exist yet, so only these are ever made
+ALTER TABLE notifications
+ADD CONSTRAINT notifications_type_check CHECK (type IN ('follow', 'mention'));
+
+-- +goose Down
+ALTER TABLE notifications
+DROP CONSTRAINT notifications_type_check;
+
+ALTER TABLE users
+DROP COLUMN handle;